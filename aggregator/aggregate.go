@@ -0,0 +1,267 @@
+package aggregator
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Scope labels used on rollup metrics
+const (
+	scopeCluster   = "cluster"
+	scopePartition = "partition"
+	scopeGroup     = "group"
+)
+
+type rollupKey struct {
+	scope, name string
+}
+
+type rollup struct {
+	nodes          int
+	idleNodes      int
+	mean, median   float64
+	p10            float64
+	gpuHoursWasted float64
+}
+
+type aggregateCollector struct {
+	scoreMeanDesc      *prometheus.Desc
+	scoreMedianDesc    *prometheus.Desc
+	scoreP10Desc       *prometheus.Desc
+	nodesDesc          *prometheus.Desc
+	idleNodesDesc      *prometheus.Desc
+	gpuHoursWastedDesc *prometheus.Desc
+	nodeUpDesc         *prometheus.Desc
+	nodeScoreDesc      *prometheus.Desc
+
+	client        *http.Client
+	targets       []Target
+	idleThreshold float64
+
+	mu             sync.Mutex
+	samples        map[string]nodeSample
+	gpuHoursWasted map[rollupKey]float64 // Running totals, only ever grow
+	lastPoll       time.Time
+}
+
+func NewAggregateCollector(targets []Target, client *http.Client, idleThreshold float64) *aggregateCollector {
+	labels := []string{"scope", "name"}
+	return &aggregateCollector{
+		scoreMeanDesc: prometheus.NewDesc(
+			"syscore_agg_score_mean",
+			"Mean utilization score across reachable nodes",
+			labels,
+			nil,
+		),
+		scoreMedianDesc: prometheus.NewDesc(
+			"syscore_agg_score_median",
+			"Median utilization score across reachable nodes",
+			labels,
+			nil,
+		),
+		scoreP10Desc: prometheus.NewDesc(
+			"syscore_agg_score_p10",
+			"10th percentile utilization score across reachable nodes",
+			labels,
+			nil,
+		),
+		nodesDesc: prometheus.NewDesc(
+			"syscore_agg_nodes",
+			"Number of reachable nodes",
+			labels,
+			nil,
+		),
+		idleNodesDesc: prometheus.NewDesc(
+			"syscore_agg_idle_nodes",
+			"Number of nodes with a score under the idle threshold",
+			labels,
+			nil,
+		),
+		gpuHoursWastedDesc: prometheus.NewDesc(
+			"syscore_agg_gpu_hours_wasted_total",
+			"GPU hours left unused (GPU count x (1 - GPU util)) since the aggregator started",
+			labels,
+			nil,
+		),
+		nodeUpDesc: prometheus.NewDesc(
+			"syscore_agg_node_up",
+			"Whether the last scrape of the node exporter succeeded",
+			[]string{"node"},
+			nil,
+		),
+		nodeScoreDesc: prometheus.NewDesc(
+			"syscore_agg_node_score",
+			"Utilization score reported by the node exporter",
+			[]string{"node"},
+			nil,
+		),
+		client:         client,
+		targets:        targets,
+		idleThreshold:  idleThreshold,
+		samples:        make(map[string]nodeSample),
+		gpuHoursWasted: make(map[rollupKey]float64),
+	}
+}
+
+// Run polls every exporter on the given interval until the process exits
+func (ac *aggregateCollector) Run(interval time.Duration) {
+	ac.Poll()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ac.Poll()
+	}
+}
+
+// Poll scrapes all targets concurrently and folds the results into the rollups
+func (ac *aggregateCollector) Poll() {
+	samples := make(map[string]nodeSample, len(ac.targets))
+	var samplesMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, target := range ac.targets {
+		wg.Add(1)
+		go func(target Target) {
+			defer wg.Done()
+			sample, err := scrapeNode(ac.client, target.URL)
+			if err != nil {
+				log.Printf("WARNING: Failed to scrape %s: %v", target.Node, err)
+			}
+			samplesMu.Lock()
+			samples[target.Node] = sample
+			samplesMu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := time.Now()
+	if !ac.lastPoll.IsZero() {
+		// Charge the elapsed time using the utilization we see now
+		hours := now.Sub(ac.lastPoll).Hours()
+		for _, target := range ac.targets {
+			sample := samples[target.Node]
+			if !sample.up || sample.gpuCount == 0 {
+				continue
+			}
+			wasted := float64(sample.gpuCount) * (1 - sample.gpuUtil) * hours
+			for _, key := range rollupKeys(target) {
+				ac.gpuHoursWasted[key] += wasted
+			}
+		}
+	}
+	ac.samples = samples
+	ac.lastPoll = now
+}
+
+func (ac *aggregateCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(ac, ch)
+}
+
+func (ac *aggregateCollector) Collect(ch chan<- prometheus.Metric) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	for _, target := range ac.targets {
+		sample, ok := ac.samples[target.Node]
+		up := 0.0
+		if ok && sample.up {
+			up = 1.0
+			ch <- prometheus.MustNewConstMetric(
+				ac.nodeScoreDesc,
+				prometheus.GaugeValue,
+				sample.score,
+				target.Node,
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ac.nodeUpDesc,
+			prometheus.GaugeValue,
+			up,
+			target.Node,
+		)
+	}
+
+	for key, r := range ac.rollups() {
+		ch <- prometheus.MustNewConstMetric(ac.nodesDesc, prometheus.GaugeValue, float64(r.nodes), key.scope, key.name)
+		ch <- prometheus.MustNewConstMetric(ac.idleNodesDesc, prometheus.GaugeValue, float64(r.idleNodes), key.scope, key.name)
+		ch <- prometheus.MustNewConstMetric(ac.gpuHoursWastedDesc, prometheus.CounterValue, r.gpuHoursWasted, key.scope, key.name)
+		if r.nodes == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(ac.scoreMeanDesc, prometheus.GaugeValue, r.mean, key.scope, key.name)
+		ch <- prometheus.MustNewConstMetric(ac.scoreMedianDesc, prometheus.GaugeValue, r.median, key.scope, key.name)
+		ch <- prometheus.MustNewConstMetric(ac.scoreP10Desc, prometheus.GaugeValue, r.p10, key.scope, key.name)
+	}
+}
+
+// rollups groups the latest samples by cluster, partition and node group. Caller holds ac.mu
+func (ac *aggregateCollector) rollups() map[rollupKey]rollup {
+	scores := make(map[rollupKey][]float64)
+	for _, target := range ac.targets {
+		sample := ac.samples[target.Node]
+		for _, key := range rollupKeys(target) {
+			if _, ok := scores[key]; !ok {
+				scores[key] = nil
+			}
+			if sample.up {
+				scores[key] = append(scores[key], sample.score)
+			}
+		}
+	}
+
+	rollups := make(map[rollupKey]rollup, len(scores))
+	for key, values := range scores {
+		r := rollup{
+			nodes:          len(values),
+			gpuHoursWasted: ac.gpuHoursWasted[key],
+		}
+		if len(values) > 0 {
+			sort.Float64s(values)
+			var sum float64
+			for _, v := range values {
+				sum += v
+				if v < ac.idleThreshold {
+					r.idleNodes++
+				}
+			}
+			r.mean = sum / float64(len(values))
+			r.median = percentile(values, 50)
+			r.p10 = percentile(values, 10)
+		}
+		rollups[key] = r
+	}
+	return rollups
+}
+
+func rollupKeys(target Target) []rollupKey {
+	keys := []rollupKey{{scopeCluster, scopeCluster}}
+	for _, partition := range target.Partitions {
+		keys = append(keys, rollupKey{scopePartition, partition})
+	}
+	if target.Group != "" {
+		keys = append(keys, rollupKey{scopeGroup, target.Group})
+	}
+	return keys
+}
+
+// percentile uses linear interpolation between closest ranks. values must be sorted
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 1 {
+		return values[0]
+	}
+	rank := p / 100 * float64(len(values)-1)
+	lower := int(rank)
+	if lower >= len(values)-1 {
+		return values[len(values)-1]
+	}
+	frac := rank - float64(lower)
+	return values[lower] + frac*(values[lower+1]-values[lower])
+}
@@ -0,0 +1,113 @@
+package aggregator
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{7}, 10, 7},
+		{[]float64{1, 2, 3, 4, 5}, 50, 3},
+		{[]float64{1, 2, 3, 4}, 50, 2.5},
+		{[]float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, 10, 10},
+		{[]float64{10, 20}, 10, 11},
+		{[]float64{10, 20}, 100, 20},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.values, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestRollups(t *testing.T) {
+	gpu1 := fakeExporter(t, 80, 100, 100)
+	gpu2 := fakeExporter(t, 2, 0, 0)
+	cpu1 := fakeExporter(t, 40)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	targets := []Target{
+		{Node: "gpu1", URL: gpu1.URL + "/metrics", Partitions: []string{"gpu"}, Group: "mi100"},
+		{Node: "gpu2", URL: gpu2.URL + "/metrics", Partitions: []string{"gpu", "debug"}, Group: "mi100"},
+		{Node: "cpu1", URL: cpu1.URL + "/metrics", Partitions: []string{"cpu", "debug"}},
+		{Node: "cpu2", URL: down.URL + "/metrics", Partitions: []string{"cpu"}},
+	}
+	ac := NewAggregateCollector(targets, http.DefaultClient, 5)
+	ac.Poll()
+
+	ac.mu.Lock()
+	rollups := ac.rollups()
+	ac.mu.Unlock()
+
+	tests := []struct {
+		key          rollupKey
+		nodes, idle  int
+		mean, median float64
+	}{
+		{rollupKey{scopeCluster, scopeCluster}, 3, 1, (80 + 2 + 40) / 3.0, 40},
+		{rollupKey{scopePartition, "gpu"}, 2, 1, 41, 41},
+		{rollupKey{scopePartition, "debug"}, 2, 1, 21, 21},
+		{rollupKey{scopePartition, "cpu"}, 1, 0, 40, 40}, // cpu2 is down
+		{rollupKey{scopeGroup, "mi100"}, 2, 1, 41, 41},
+	}
+	for _, tt := range tests {
+		r, ok := rollups[tt.key]
+		if !ok {
+			t.Errorf("missing rollup %v", tt.key)
+			continue
+		}
+		if r.nodes != tt.nodes || r.idleNodes != tt.idle || math.Abs(r.mean-tt.mean) > 1e-9 || r.median != tt.median {
+			t.Errorf("%v = %+v, want nodes=%d idle=%d mean=%v median=%v", tt.key, r, tt.nodes, tt.idle, tt.mean, tt.median)
+		}
+	}
+	if len(rollups) != len(tests) {
+		t.Errorf("got %d rollups, want %d", len(rollups), len(tests))
+	}
+}
+
+func TestGPUHoursWasted(t *testing.T) {
+	busy := fakeExporter(t, 90, 100, 100)  // Nothing wasted
+	idle := fakeExporter(t, 1, 0, 0, 0, 0) // 4 GPUs fully idle
+	half := fakeExporter(t, 50, 50, 50)    // 2 GPUs half used
+
+	targets := []Target{
+		{Node: "busy", URL: busy.URL + "/metrics", Partitions: []string{"gpu"}},
+		{Node: "idle", URL: idle.URL + "/metrics", Partitions: []string{"gpu"}},
+		{Node: "half", URL: half.URL + "/metrics", Group: "old"},
+	}
+	ac := NewAggregateCollector(targets, http.DefaultClient, 5)
+
+	// The first poll only sets the starting point
+	ac.Poll()
+	if got := ac.gpuHoursWasted[rollupKey{scopeCluster, scopeCluster}]; got != 0 {
+		t.Fatalf("wasted after first poll = %v, want 0", got)
+	}
+
+	// Pretend each later poll comes an hour after the previous one
+	for i := 0; i < 2; i++ {
+		ac.mu.Lock()
+		ac.lastPoll = time.Now().Add(-time.Hour)
+		ac.mu.Unlock()
+		ac.Poll()
+	}
+
+	want := map[rollupKey]float64{
+		{scopeCluster, scopeCluster}: 2 * (4 + 1),
+		{scopePartition, "gpu"}:      2 * 4,
+		{scopeGroup, "old"}:          2 * 1,
+	}
+	for key, hours := range want {
+		if got := ac.gpuHoursWasted[key]; math.Abs(got-hours) > 0.01 {
+			t.Errorf("%v wasted = %v, want %v", key, got, hours)
+		}
+	}
+}
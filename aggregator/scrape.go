@@ -0,0 +1,58 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// nodeSample is what we keep from a single exporter scrape
+type nodeSample struct {
+	up       bool
+	score    float64 // syscore_utilization_score_weighted (0-100)
+	gpuCount int     // number of cards reporting syscore_gpu_busy_percent
+	gpuUtil  float64 // syscore_gpu_avg_util as 0-1
+}
+
+func scrapeNode(client *http.Client, url string) (nodeSample, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nodeSample{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nodeSample{}, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nodeSample{}, fmt.Errorf("parsing %s: %w", url, err)
+	}
+
+	sample := nodeSample{up: true}
+	score, ok := firstGauge(families["syscore_utilization_score_weighted"])
+	if !ok {
+		return nodeSample{}, fmt.Errorf("%s has no syscore_utilization_score_weighted", url)
+	}
+	sample.score = score
+
+	if family := families["syscore_gpu_busy_percent"]; family != nil {
+		sample.gpuCount = len(family.GetMetric())
+	}
+	if util, ok := firstGauge(families["syscore_gpu_avg_util"]); ok {
+		sample.gpuUtil = util / 100
+	}
+	return sample, nil
+}
+
+func firstGauge(family *dto.MetricFamily) (float64, bool) {
+	if family == nil || len(family.GetMetric()) == 0 {
+		return 0, false
+	}
+	return family.GetMetric()[0].GetGauge().GetValue(), true
+}
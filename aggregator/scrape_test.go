@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeExporter serves a minimal node exporter /metrics page
+func fakeExporter(t *testing.T, score float64, gpuUtils ...float64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# TYPE syscore_utilization_score_weighted gauge\nsyscore_utilization_score_weighted %g\n", score)
+		if len(gpuUtils) == 0 {
+			return
+		}
+		var sum float64
+		fmt.Fprintln(w, "# TYPE syscore_gpu_busy_percent gauge")
+		for i, util := range gpuUtils {
+			fmt.Fprintf(w, "syscore_gpu_busy_percent{card=\"card%d\",id=\"%d\"} %g\n", i, i, util)
+			sum += util
+		}
+		fmt.Fprintf(w, "# TYPE syscore_gpu_avg_util gauge\nsyscore_gpu_avg_util %g\n", sum/float64(len(gpuUtils)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestScrapeNode(t *testing.T) {
+	server := fakeExporter(t, 42.5, 100, 0, 50, 50)
+
+	sample, err := scrapeNode(server.Client(), server.URL+"/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sample.up || sample.score != 42.5 || sample.gpuCount != 4 || sample.gpuUtil != 0.5 {
+		t.Errorf("sample = %+v", sample)
+	}
+}
+
+func TestScrapeNodeCPUOnly(t *testing.T) {
+	server := fakeExporter(t, 10)
+
+	sample, err := scrapeNode(server.Client(), server.URL+"/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample.gpuCount != 0 || sample.gpuUtil != 0 {
+		t.Errorf("sample = %+v, want no GPUs", sample)
+	}
+}
+
+func TestScrapeNodeErrors(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	handlers := map[string]http.HandlerFunc{
+		"bad status": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		},
+		"bad body": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "this is { not prometheus text")
+		},
+		"no score": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "# TYPE other gauge\nother 1")
+		},
+	}
+
+	t.Run("down", func(t *testing.T) {
+		sample, err := scrapeNode(http.DefaultClient, downURL+"/metrics")
+		if err == nil || sample.up {
+			t.Errorf("sample = %+v, err = %v, want a down node", sample, err)
+		}
+	})
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			sample, err := scrapeNode(server.Client(), server.URL+"/metrics")
+			if err == nil || sample.up {
+				t.Errorf("sample = %+v, err = %v, want a down node", sample, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package aggregator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Target is a single exporter the aggregator scrapes
+type Target struct {
+	Node       string   // Node name used as label
+	URL        string   // Full /metrics URL
+	Partitions []string // Slurm partitions the node belongs to
+	Group      string   // Optional node group (e.g. hardware generation)
+}
+
+// LoadTargetsFile reads a static target list. One exporter per line:
+//
+//	node01:9110 partition=gpu group=mi100
+//	node02:9110 partition=cpu,debug
+//	https://node03.example.org:9443/metrics node=node03
+//
+// The node label is the address's host unless node= is given, and must be unique.
+// Blank lines and lines starting with # are ignored.
+func LoadTargetsFile(path string) ([]Target, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var targets []Target
+	seen := make(map[string]int) // Node -> line it was defined on
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+
+		target := Target{URL: metricsURL(fields[0])}
+		parsed, err := url.Parse(target.URL)
+		if err != nil || parsed.Hostname() == "" {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, lineNum, fields[0])
+		}
+		target.Node = parsed.Hostname()
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: expected key=value, got %q", path, lineNum, field)
+			}
+			switch key {
+			case "partition":
+				target.Partitions = strings.Split(value, ",")
+			case "group":
+				target.Group = value
+			case "node":
+				target.Node = value
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown key %q", path, lineNum, key)
+			}
+		}
+		// Samples and labels are keyed by node, a duplicate would silently replace the first
+		if prev, ok := seen[target.Node]; ok {
+			return nil, fmt.Errorf("%s:%d: node %q already defined on line %d", path, lineNum, target.Node, prev)
+		}
+		seen[target.Node] = lineNum
+		targets = append(targets, target)
+	}
+	return targets, scanner.Err()
+}
+
+// SlurmTargets builds the target list from sinfo, one exporter per node on the given port
+func SlurmTargets(port int, timeout time.Duration) ([]Target, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// One line per node/partition pair
+	output, err := exec.CommandContext(ctx, "sinfo", "-h", "-N", "-o", "%N %R").Output()
+	if err != nil {
+		return nil, fmt.Errorf("sinfo: %w", err)
+	}
+	return parseSinfoNodes(string(output), port), nil
+}
+
+func parseSinfoNodes(output string, port int) []Target {
+	byNode := make(map[string]*Target)
+	var order []string
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		node, partition := fields[0], fields[1]
+
+		target, ok := byNode[node]
+		if !ok {
+			target = &Target{
+				Node: node,
+				URL:  metricsURL(fmt.Sprintf("%s:%d", node, port)),
+			}
+			byNode[node] = target
+			order = append(order, node)
+		}
+		target.Partitions = append(target.Partitions, partition)
+	}
+
+	targets := make([]Target, 0, len(order))
+	for _, node := range order {
+		targets = append(targets, *byNode[node])
+	}
+	return targets
+}
+
+func metricsURL(address string) string {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+	if !strings.HasSuffix(address, "/metrics") {
+		address = strings.TrimSuffix(address, "/") + "/metrics"
+	}
+	return address
+}
@@ -0,0 +1,74 @@
+package aggregator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTargetsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "targets")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTargetsFile(t *testing.T) {
+	path := writeTargetsFile(t, `# GPU nodes
+node01:9110 partition=gpu group=mi100
+
+node02:9110 partition=cpu,debug
+https://node03.example.org:9443/metrics node=node03
+https://node04:9443
+http://node05/
+`)
+	targets, err := LoadTargetsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Target{
+		{Node: "node01", URL: "http://node01:9110/metrics", Partitions: []string{"gpu"}, Group: "mi100"},
+		{Node: "node02", URL: "http://node02:9110/metrics", Partitions: []string{"cpu", "debug"}},
+		{Node: "node03", URL: "https://node03.example.org:9443/metrics"},
+		{Node: "node04", URL: "https://node04:9443/metrics"},
+		{Node: "node05", URL: "http://node05/metrics"},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %+v\nwant %+v", targets, want)
+	}
+}
+
+func TestLoadTargetsFileErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing value":  "node01:9110 gpu\n",
+		"unknown key":    "node01:9110 rack=3\n",
+		"no host":        "http://:9110\n",
+		"duplicate":      "node01:9110\nhttps://node01:9443\n",
+		"duplicate name": "node01:9110\nnode02:9110 node=node01\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadTargetsFile(writeTargetsFile(t, content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+	if _, err := LoadTargetsFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestParseSinfoNodes(t *testing.T) {
+	output := "gpu01 gpu\ngpu01 debug\ncpu01 cpu\n\ncpu02 cpu\n"
+	targets := parseSinfoNodes(output, 9110)
+	want := []Target{
+		{Node: "gpu01", URL: "http://gpu01:9110/metrics", Partitions: []string{"gpu", "debug"}},
+		{Node: "cpu01", URL: "http://cpu01:9110/metrics", Partitions: []string{"cpu"}},
+		{Node: "cpu02", URL: "http://cpu02:9110/metrics", Partitions: []string{"cpu"}},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %+v\nwant %+v", targets, want)
+	}
+}
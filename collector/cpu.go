@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"runtime"
 	"strconv"
 	"strings"
 
+	"github.com/amitch747/system-scorer/utility"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
 )
 
 type cpuTimes struct {
@@ -16,20 +17,45 @@ type cpuTimes struct {
 }
 
 var (
-	prevCPUTimes  cpuTimes // Times from scrape 15s before current
-	SharedCPUExec float64  // Used in score.go to avoid double scrape
+	prevCPUTimes    cpuTimes         // Times from scrape 15s before current
+	prevPerCPUTimes map[int]cpuTimes // Same, per logical CPU
+	SharedCPUExec   float64          // Used in score.go to avoid double scrape
+
+	SharedRunqueueRatio float64 // Runnable tasks per online CPU, used in score.go
 )
 
 type CPUCollector struct {
-	cpuCountDesc *prometheus.Desc
-	cpuExecDesc  *prometheus.Desc
+	cpuCountDesc      *prometheus.Desc
+	cpuOnlineDesc     *prometheus.Desc
+	cpuIsolatedDesc   *prometheus.Desc
+	cpuExecDesc       *prometheus.Desc
+	cpuModeRatioDesc  *prometheus.Desc
+	loadAvgDesc       *prometheus.Desc
+	procsRunningDesc  *prometheus.Desc
+	procsBlockedDesc  *prometheus.Desc
+	runqueueRatioDesc *prometheus.Desc
+	cpuCoreExecDesc   *prometheus.Desc
+	cpuNUMAExecDesc   *prometheus.Desc
+	cpuImbalanceDesc  *prometheus.Desc
 }
 
 func NewCPUCollector() *CPUCollector {
 	return &CPUCollector{
 		cpuCountDesc: prometheus.NewDesc(
 			"syscore_cpu_count",
-			"Number of CPU cores",
+			"Number of CPUs usable for work (online, not isolated, inside the Slurm cpuset if set)",
+			nil,
+			nil,
+		),
+		cpuOnlineDesc: prometheus.NewDesc(
+			"syscore_cpu_online",
+			"Number of online CPUs",
+			nil,
+			nil,
+		),
+		cpuIsolatedDesc: prometheus.NewDesc(
+			"syscore_cpu_isolated",
+			"Number of CPUs isolated from the scheduler (isolcpus)",
 			nil,
 			nil,
 		),
@@ -39,6 +65,54 @@ func NewCPUCollector() *CPUCollector {
 			nil,
 			nil,
 		),
+		cpuModeRatioDesc: prometheus.NewDesc(
+			"syscore_cpu_mode_ratio",
+			"15s fraction of CPU time spent in each mode (0-1)",
+			[]string{"mode"},
+			nil,
+		),
+		loadAvgDesc: prometheus.NewDesc(
+			"syscore_cpu_load_average",
+			"System load average from /proc/loadavg",
+			[]string{"window"},
+			nil,
+		),
+		procsRunningDesc: prometheus.NewDesc(
+			"syscore_cpu_procs_running",
+			"Number of runnable tasks",
+			nil,
+			nil,
+		),
+		procsBlockedDesc: prometheus.NewDesc(
+			"syscore_cpu_procs_blocked",
+			"Number of tasks blocked on IO",
+			nil,
+			nil,
+		),
+		runqueueRatioDesc: prometheus.NewDesc(
+			"syscore_cpu_runqueue_ratio",
+			"Runnable tasks per online CPU (above 1 means tasks are waiting for a CPU)",
+			nil,
+			nil,
+		),
+		cpuCoreExecDesc: prometheus.NewDesc(
+			"syscore_cpu_core_exec",
+			"15s percentage of CPU time spent not in idle or iowait per logical CPU (0-100)",
+			[]string{"cpu", "core", "node"},
+			nil,
+		),
+		cpuNUMAExecDesc: prometheus.NewDesc(
+			"syscore_cpu_numa_exec",
+			"15s percentage of CPU time spent not in idle or iowait per NUMA node (0-100)",
+			[]string{"node"},
+			nil,
+		),
+		cpuImbalanceDesc: prometheus.NewDesc(
+			"syscore_cpu_numa_imbalance",
+			"Difference between the busiest and idlest NUMA node exec (0-100)",
+			nil,
+			nil,
+		),
 	}
 }
 
@@ -47,58 +121,256 @@ func (cc *CPUCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (cc *CPUCollector) Collect(ch chan<- prometheus.Metric) {
+	capacity := utility.GetCPUCapacity()
 	// Collect cpuCount
 	ch <- prometheus.MustNewConstMetric(
 		cc.cpuCountDesc,
 		prometheus.GaugeValue,
-		float64(runtime.NumCPU()),
+		float64(len(capacity.Usable)),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		cc.cpuOnlineDesc,
+		prometheus.GaugeValue,
+		float64(len(capacity.Online)),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		cc.cpuIsolatedDesc,
+		prometheus.GaugeValue,
+		float64(len(capacity.Isolated)),
 	)
 
-	currCPUTimes, err := readCPUTimes()
+	stat, err := readProcStat()
 	if err != nil {
 		return
 	}
-	cpuExec := calcCPUExec(prevCPUTimes, currCPUTimes)
-	// Save exec for use in score.go
-	SharedCPUExec = cpuExec
-	// Update for next scrape
-	prevCPUTimes = currCPUTimes
+	currCPUTimes, currPerCPUTimes := stat.total, stat.perCPU
+	cc.collectRunQueue(ch, stat, len(capacity.Online))
+
+	prevUsable, currUsable := prevCPUTimes, currCPUTimes
+	// Only count CPUs work can actually run on, idle isolated CPUs would drag exec down
+	if len(capacity.Usable) > 0 {
+		prevUsable, currUsable = sumCPUTimes(prevPerCPUTimes, currPerCPUTimes, capacity.Usable)
+	}
+	cpuExec := calcCPUExec(prevUsable, currUsable)
+	// Save useful exec for use in score.go
+	SharedCPUExec = calcCPUUseful(prevUsable, currUsable)
+
+	for mode, ratio := range calcCPUModeRatios(prevUsable, currUsable) {
+		ch <- prometheus.MustNewConstMetric(
+			cc.cpuModeRatioDesc,
+			prometheus.GaugeValue,
+			ratio,
+			mode,
+		)
+	}
 	// Collect cpuExec as percentage (0-100) for Prometheus
 	ch <- prometheus.MustNewConstMetric(
 		cc.cpuExecDesc,
 		prometheus.GaugeValue,
 		cpuExec*100,
 	)
+
+	if prevPerCPUTimes != nil {
+		cc.collectTopology(ch, prevPerCPUTimes, currPerCPUTimes)
+	}
+
+	// Update for next scrape
+	prevCPUTimes = currCPUTimes
+	prevPerCPUTimes = currPerCPUTimes
+}
+
+// collectRunQueue exports load averages and runnable tasks per online CPU
+func (cc *CPUCollector) collectRunQueue(ch chan<- prometheus.Metric, stat procStat, onlineCPUs int) {
+	ch <- prometheus.MustNewConstMetric(
+		cc.procsRunningDesc,
+		prometheus.GaugeValue,
+		float64(stat.procsRunning),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		cc.procsBlockedDesc,
+		prometheus.GaugeValue,
+		float64(stat.procsBlocked),
+	)
+
+	if onlineCPUs > 0 {
+		// procs_running counts this exporter while it reads /proc/stat
+		runnable := float64(stat.procsRunning) - 1
+		if runnable < 0 {
+			runnable = 0
+		}
+		ratio := runnable / float64(onlineCPUs)
+		// Save for use in score.go
+		SharedRunqueueRatio = ratio
+		ch <- prometheus.MustNewConstMetric(
+			cc.runqueueRatioDesc,
+			prometheus.GaugeValue,
+			ratio,
+		)
+	}
+
+	fs, err := procfs.NewFS("/proc")
+	if err != nil {
+		return
+	}
+	load, err := fs.LoadAvg()
+	if err != nil {
+		return
+	}
+	windows := map[string]float64{"1m": load.Load1, "5m": load.Load5, "15m": load.Load15}
+	for window, value := range windows {
+		ch <- prometheus.MustNewConstMetric(
+			cc.loadAvgDesc,
+			prometheus.GaugeValue,
+			value,
+			window,
+		)
+	}
 }
 
-func readCPUTimes() (cpuTimes, error) {
+// collectTopology exports per-CPU and per-NUMA exec plus the NUMA imbalance
+func (cc *CPUCollector) collectTopology(ch chan<- prometheus.Metric, prev, curr map[int]cpuTimes) {
+	topology := utility.GetCPUTopology()
+
+	// Sum times per node so each node's exec is weighted by its CPUs
+	prevNode := make(map[int]cpuTimes)
+	currNode := make(map[int]cpuTimes)
+
+	for cpu, currTimes := range curr {
+		prevTimes, ok := prev[cpu]
+		if !ok {
+			continue // CPU came online since last scrape
+		}
+		t := topology[cpu]
+		ch <- prometheus.MustNewConstMetric(
+			cc.cpuCoreExecDesc,
+			prometheus.GaugeValue,
+			calcCPUExec(prevTimes, currTimes)*100,
+			strconv.Itoa(cpu), fmt.Sprintf("%d-%d", t.Package, t.Core), strconv.Itoa(t.Node),
+		)
+		prevNode[t.Node] = prevNode[t.Node].add(prevTimes)
+		currNode[t.Node] = currNode[t.Node].add(currTimes)
+	}
+
+	var minExec, maxExec float64
+	first := true
+	for node, currTimes := range currNode {
+		exec := calcCPUExec(prevNode[node], currTimes)
+		ch <- prometheus.MustNewConstMetric(
+			cc.cpuNUMAExecDesc,
+			prometheus.GaugeValue,
+			exec*100,
+			strconv.Itoa(node),
+		)
+		if first || exec < minExec {
+			minExec = exec
+		}
+		if first || exec > maxExec {
+			maxExec = exec
+		}
+		first = false
+	}
+	if !first {
+		ch <- prometheus.MustNewConstMetric(
+			cc.cpuImbalanceDesc,
+			prometheus.GaugeValue,
+			(maxExec-minExec)*100,
+		)
+	}
+}
+
+// sumCPUTimes adds up the given CPUs. A CPU missing from prev (new since last scrape) is skipped,
+// while a nil prev (first scrape) sums against zero like the aggregate line does
+func sumCPUTimes(prev, curr map[int]cpuTimes, cpus []int) (cpuTimes, cpuTimes) {
+	var prevSum, currSum cpuTimes
+	for _, cpu := range cpus {
+		currTimes, ok := curr[cpu]
+		if !ok {
+			continue
+		}
+		prevTimes, ok := prev[cpu]
+		if !ok && prev != nil {
+			continue
+		}
+		prevSum = prevSum.add(prevTimes)
+		currSum = currSum.add(currTimes)
+	}
+	return prevSum, currSum
+}
+
+// procStat is the part of /proc/stat we care about
+type procStat struct {
+	total        cpuTimes
+	perCPU       map[int]cpuTimes
+	procsRunning uint64
+	procsBlocked uint64
+}
+
+// readProcStat returns the aggregate cpu line, every cpuN line and the run queue counts
+func readProcStat() (procStat, error) {
 	file, err := os.Open("/proc/stat")
 	if err != nil {
-		return cpuTimes{}, err
+		return procStat{}, err
 	}
 	defer file.Close()
 
 	// Wrap file in scanner
 	scanner := bufio.NewScanner(file)
-	var cpuT cpuTimes
+	stat := procStat{perCPU: make(map[int]cpuTimes)}
+	var found bool
 	// Read until there are no more lines
 	for scanner.Scan() {
 		// Seperate scanned line in a slice
 		fields := strings.Fields(scanner.Text())
-		if fields[0] == "cpu" {
-			// Convert each uint64 into a string
-			cpuT.user, _ = strconv.ParseUint(fields[1], 10, 64)
-			cpuT.nice, _ = strconv.ParseUint(fields[2], 10, 64)
-			cpuT.system, _ = strconv.ParseUint(fields[3], 10, 64)
-			cpuT.idle, _ = strconv.ParseUint(fields[4], 10, 64)
-			cpuT.iowait, _ = strconv.ParseUint(fields[5], 10, 64)
-			cpuT.irq, _ = strconv.ParseUint(fields[6], 10, 64)
-			cpuT.softirq, _ = strconv.ParseUint(fields[7], 10, 64)
-			cpuT.steal, _ = strconv.ParseUint(fields[8], 10, 64)
-			return cpuT, nil
+		if len(fields) < 2 {
+			continue
 		}
+		switch {
+		case fields[0] == "procs_running":
+			stat.procsRunning, _ = strconv.ParseUint(fields[1], 10, 64)
+		case fields[0] == "procs_blocked":
+			stat.procsBlocked, _ = strconv.ParseUint(fields[1], 10, 64)
+		case len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu"):
+			continue
+		case fields[0] == "cpu":
+			stat.total = parseCPUTimes(fields)
+			found = true
+		default:
+			if cpu, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu")); err == nil {
+				stat.perCPU[cpu] = parseCPUTimes(fields)
+			}
+		}
+	}
+	if !found {
+		return procStat{}, fmt.Errorf("cpu line not found")
+	}
+	return stat, nil
+}
+
+func parseCPUTimes(fields []string) cpuTimes {
+	var cpuT cpuTimes
+	// Convert each string into a uint64
+	cpuT.user, _ = strconv.ParseUint(fields[1], 10, 64)
+	cpuT.nice, _ = strconv.ParseUint(fields[2], 10, 64)
+	cpuT.system, _ = strconv.ParseUint(fields[3], 10, 64)
+	cpuT.idle, _ = strconv.ParseUint(fields[4], 10, 64)
+	cpuT.iowait, _ = strconv.ParseUint(fields[5], 10, 64)
+	cpuT.irq, _ = strconv.ParseUint(fields[6], 10, 64)
+	cpuT.softirq, _ = strconv.ParseUint(fields[7], 10, 64)
+	cpuT.steal, _ = strconv.ParseUint(fields[8], 10, 64)
+	return cpuT
+}
+
+func (cpuT cpuTimes) add(other cpuTimes) cpuTimes {
+	return cpuTimes{
+		user:    cpuT.user + other.user,
+		nice:    cpuT.nice + other.nice,
+		system:  cpuT.system + other.system,
+		idle:    cpuT.idle + other.idle,
+		iowait:  cpuT.iowait + other.iowait,
+		irq:     cpuT.irq + other.irq,
+		softirq: cpuT.softirq + other.softirq,
+		steal:   cpuT.steal + other.steal,
 	}
-	return cpuTimes{}, fmt.Errorf("cpu line not found")
 }
 
 func (cpuT cpuTimes) CalcTotalCPUTime() uint64 {
@@ -110,6 +382,10 @@ func calcCPUExec(prev, curr cpuTimes) float64 {
 	totalPrev := prev.CalcTotalCPUTime()
 	totalCurr := curr.CalcTotalCPUTime()
 
+	// Counters can go backwards when a CPU is taken offline
+	if totalCurr <= totalPrev {
+		return 0
+	}
 	totalDelta := float64(totalCurr - totalPrev)
 	if totalDelta <= 0 {
 		return 0
@@ -119,3 +395,61 @@ func calcCPUExec(prev, curr cpuTimes) float64 {
 	// Return as 0-1 for internal use
 	return 1 - idleTime/totalDelta
 }
+
+// calcCPUUseful is exec as used by the score. Steal is time the hypervisor gave to
+// someone else, so it leaves the denominator too. System/irq time still counts as
+// available, it just isn't useful work
+func calcCPUUseful(prev, curr cpuTimes) float64 {
+	if !CPUExcludeSteal && !CPUExcludeSystem {
+		return calcCPUExec(prev, curr)
+	}
+	totalPrev := prev.CalcTotalCPUTime()
+	totalCurr := curr.CalcTotalCPUTime()
+	if totalCurr <= totalPrev {
+		return 0
+	}
+	totalDelta := float64(totalCurr - totalPrev)
+	busy := totalDelta - delta(prev.idle, curr.idle) - delta(prev.iowait, curr.iowait)
+
+	if CPUExcludeSteal {
+		steal := delta(prev.steal, curr.steal)
+		busy -= steal
+		totalDelta -= steal
+	}
+	if CPUExcludeSystem {
+		busy -= delta(prev.system, curr.system) + delta(prev.irq, curr.irq) + delta(prev.softirq, curr.softirq)
+	}
+	if totalDelta <= 0 || busy <= 0 {
+		return 0
+	}
+	return busy / totalDelta
+}
+
+func calcCPUModeRatios(prev, curr cpuTimes) map[string]float64 {
+	ratios := make(map[string]float64)
+	totalPrev := prev.CalcTotalCPUTime()
+	totalCurr := curr.CalcTotalCPUTime()
+	if totalCurr <= totalPrev {
+		return ratios
+	}
+	totalDelta := float64(totalCurr - totalPrev)
+
+	ratios["user"] = delta(prev.user, curr.user) / totalDelta
+	ratios["nice"] = delta(prev.nice, curr.nice) / totalDelta
+	ratios["system"] = delta(prev.system, curr.system) / totalDelta
+	ratios["idle"] = delta(prev.idle, curr.idle) / totalDelta
+	ratios["iowait"] = delta(prev.iowait, curr.iowait) / totalDelta
+	ratios["irq"] = delta(prev.irq, curr.irq) / totalDelta
+	ratios["softirq"] = delta(prev.softirq, curr.softirq) / totalDelta
+	ratios["steal"] = delta(prev.steal, curr.steal) / totalDelta
+	return ratios
+}
+
+// delta is curr - prev clamped at 0. iowait in /proc/stat is documented to go backwards,
+// and a raw uint64 subtraction would wrap to ~1.8e19
+func delta(prev, curr uint64) float64 {
+	if curr < prev {
+		return 0
+	}
+	return float64(curr - prev)
+}
@@ -0,0 +1,33 @@
+package collector
+
+import "testing"
+
+func TestCalcCPUModeRatiosIowaitGoesBackwards(t *testing.T) {
+	prev := cpuTimes{user: 1000, system: 200, idle: 5000, iowait: 300}
+	curr := cpuTimes{user: 1600, system: 300, idle: 5400, iowait: 290}
+
+	ratios := calcCPUModeRatios(prev, curr)
+	if ratios["iowait"] != 0 {
+		t.Errorf("iowait = %v, want 0 when the counter goes backwards", ratios["iowait"])
+	}
+	for mode, ratio := range ratios {
+		if ratio < 0 || ratio > 1 {
+			t.Errorf("%s = %v, want 0-1", mode, ratio)
+		}
+	}
+	// Total moved by 600 + 100 + 400 - 10 = 1090
+	if want := 600.0 / 1090; ratios["user"] != want {
+		t.Errorf("user = %v, want %v", ratios["user"], want)
+	}
+}
+
+func TestCalcCPUUsefulIowaitGoesBackwards(t *testing.T) {
+	CPUExcludeSteal = true
+	t.Cleanup(func() { CPUExcludeSteal = false })
+
+	prev := cpuTimes{user: 1000, idle: 5000, iowait: 300, steal: 50}
+	curr := cpuTimes{user: 1500, idle: 5500, iowait: 280, steal: 50}
+	if got := calcCPUUseful(prev, curr); got < 0 || got > 1 {
+		t.Errorf("calcCPUUseful = %v, want 0-1", got)
+	}
+}
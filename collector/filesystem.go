@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// Capacity and inode usage of the filesystems users can fill (FSMountpoints)
+
+// Set when any watched filesystem is full, used in score.go
+var SharedFSFull bool
+
+var (
+	// Mounts with a statfs still outstanding. A hung NFS/Lustre/GPFS server keeps the call
+	// blocked, so no new one is started until it returns
+	stuckMountsMu sync.Mutex
+	stuckMounts   = make(map[string]bool)
+)
+
+type fsUsage struct {
+	fsType      string
+	sizeBytes   float64
+	freeBytes   float64 // Available to unprivileged users
+	inodes      float64
+	inodesFree  float64
+	usedRatio   float64 // 0-1, against what unprivileged users can use
+	inodesRatio float64 // 0-1
+	stale       bool    // statfs did not answer within FSStatTimeout
+}
+
+type filesystemCollector struct {
+	sizeDesc       *prometheus.Desc
+	freeDesc       *prometheus.Desc
+	inodesDesc     *prometheus.Desc
+	inodesFreeDesc *prometheus.Desc
+	fullDesc       *prometheus.Desc
+	staleDesc      *prometheus.Desc
+}
+
+func NewFilesystemCollector() *filesystemCollector {
+	return &filesystemCollector{
+		sizeDesc: prometheus.NewDesc(
+			"syscore_fs_size_bytes",
+			"Filesystem size",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+		freeDesc: prometheus.NewDesc(
+			"syscore_fs_free_bytes",
+			"Filesystem space available to unprivileged users",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+		inodesDesc: prometheus.NewDesc(
+			"syscore_fs_inodes",
+			"Filesystem inode count",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+		inodesFreeDesc: prometheus.NewDesc(
+			"syscore_fs_inodes_free",
+			"Filesystem free inodes",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+		fullDesc: prometheus.NewDesc(
+			"syscore_fs_full",
+			"1 if space or inode usage is at or above the full threshold",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+		staleDesc: prometheus.NewDesc(
+			"syscore_fs_stale",
+			"1 if statfs did not answer in time (hung network filesystem), other fs metrics are left out",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+	}
+}
+
+func (fc *filesystemCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(fc, ch)
+}
+
+func (fc *filesystemCollector) Collect(ch chan<- prometheus.Metric) {
+	anyFull := false
+	for mount, usage := range readFilesystems() {
+		if usage.stale {
+			ch <- prometheus.MustNewConstMetric(fc.staleDesc, prometheus.GaugeValue, 1, mount, usage.fsType)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(fc.staleDesc, prometheus.GaugeValue, 0, mount, usage.fsType)
+
+		full := 0.0
+		if usage.usedRatio >= FSFullThreshold || usage.inodesRatio >= FSFullThreshold {
+			full = 1
+			anyFull = true
+		}
+
+		ch <- prometheus.MustNewConstMetric(fc.sizeDesc, prometheus.GaugeValue, usage.sizeBytes, mount, usage.fsType)
+		ch <- prometheus.MustNewConstMetric(fc.freeDesc, prometheus.GaugeValue, usage.freeBytes, mount, usage.fsType)
+		ch <- prometheus.MustNewConstMetric(fc.inodesDesc, prometheus.GaugeValue, usage.inodes, mount, usage.fsType)
+		ch <- prometheus.MustNewConstMetric(fc.inodesFreeDesc, prometheus.GaugeValue, usage.inodesFree, mount, usage.fsType)
+		ch <- prometheus.MustNewConstMetric(fc.fullDesc, prometheus.GaugeValue, full, mount, usage.fsType)
+	}
+	SharedFSFull = anyFull
+}
+
+func readFilesystems() map[string]fsUsage {
+	filesystems := make(map[string]fsUsage)
+
+	mounts, err := procfs.GetMounts()
+	if err != nil {
+		return filesystems
+	}
+
+	// Later entries stack over earlier ones on the same mountpoint, statfs sees the top one
+	fsTypes := make(map[string]string)
+	for _, mount := range mounts {
+		if FSMountpoints != nil && FSMountpoints.MatchString(mount.MountPoint) {
+			fsTypes[mount.MountPoint] = mount.FSType
+		}
+	}
+
+	// All mounts in parallel so the scrape waits at most one FSStatTimeout
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for mountPoint, fsType := range fsTypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			usage, ok := statFilesystem(mountPoint, fsType)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			filesystems[mountPoint] = usage
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return filesystems
+}
+
+// statFilesystem runs statfs with a deadline. ok is false when the mount can't be read at all
+func statFilesystem(mountPoint, fsType string) (fsUsage, bool) {
+	stuckMountsMu.Lock()
+	if stuckMounts[mountPoint] {
+		stuckMountsMu.Unlock()
+		return fsUsage{fsType: fsType, stale: true}, true
+	}
+	stuckMounts[mountPoint] = true
+	stuckMountsMu.Unlock()
+
+	type result struct {
+		stat syscall.Statfs_t
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(mountPoint, &stat)
+
+		stuckMountsMu.Lock()
+		delete(stuckMounts, mountPoint)
+		stuckMountsMu.Unlock()
+		done <- result{stat, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return fsUsage{}, false
+		}
+		return calcFSUsage(fsType, r.stat), true
+	case <-time.After(FSStatTimeout):
+		log.Printf("WARNING: statfs on %s did not return within %s, marking it stale", mountPoint, FSStatTimeout)
+		return fsUsage{fsType: fsType, stale: true}, true
+	}
+}
+
+func calcFSUsage(fsType string, stat syscall.Statfs_t) fsUsage {
+	blockSize := float64(stat.Bsize)
+	usage := fsUsage{
+		fsType:     fsType,
+		sizeBytes:  float64(stat.Blocks) * blockSize,
+		freeBytes:  float64(stat.Bavail) * blockSize,
+		inodes:     float64(stat.Files),
+		inodesFree: float64(stat.Ffree),
+	}
+
+	// Reserved blocks (Bfree - Bavail) are out of reach for users, same as df's Use%
+	usable := float64(stat.Blocks-stat.Bfree) + float64(stat.Bavail)
+	if usable > 0 {
+		usage.usedRatio = float64(stat.Blocks-stat.Bfree) / usable
+	}
+	// Some filesystems (btrfs, tmpfs with nr_inodes=0) report no inode limit
+	if stat.Files > 0 {
+		usage.inodesRatio = float64(stat.Files-stat.Ffree) / float64(stat.Files)
+	}
+	return usage
+}
@@ -0,0 +1,671 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amitch747/system-scorer/utility"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Vendor-neutral GPU collector. Vendors live in utility as GPUBackend implementations
+
+type GPUCollector struct {
+	gpuBusyPercentDesc        *prometheus.Desc
+	gpuGTTSizeDesc            *prometheus.Desc
+	gpuGTTUsedDesc            *prometheus.Desc
+	gpuVisibleVRAMSizeDesc    *prometheus.Desc
+	gpuVisibleVRAMUsedDesc    *prometheus.Desc
+	gpuMemoryVRAMSizeDesc     *prometheus.Desc
+	gpuMemoryVRAMUsedDesc     *prometheus.Desc
+	gpuPowerDesc              *prometheus.Desc
+	gpuTemperatureDesc        *prometheus.Desc
+	gpuSclkDesc               *prometheus.Desc
+	gpuMemBusyPercentDesc     *prometheus.Desc
+	gpuUtilDesc               *prometheus.Desc
+	gpuAverageUtilizationDesc *prometheus.Desc
+	gpuUtilAggregateDesc      *prometheus.Desc
+	gpuPresentDesc            *prometheus.Desc
+	gpuECCErrorsDesc          *prometheus.Desc
+	gpuPCIeSpeedDesc          *prometheus.Desc
+	gpuPCIeWidthDesc          *prometheus.Desc
+	gpuThrottledDesc          *prometheus.Desc
+	gpuHealthyDesc            *prometheus.Desc
+	gpuNodeHealthyDesc        *prometheus.Desc
+	gpuLostDesc               *prometheus.Desc
+	gpuProcessVRAMDesc        *prometheus.Desc
+	gpuProcessEngineDesc      *prometheus.Desc
+	gpuUserVRAMDesc           *prometheus.Desc
+
+	processReader *utility.GPUProcessReader
+}
+
+// Used in score.go to avoid double scrape
+var (
+	SharedGpuUtil      float64
+	SharedDegradedGPUs int // Excluded from user capacity
+)
+
+// Every card seen since startup (card|id -> present on the last sample) and how many times one vanished
+var (
+	gpuPresenceMu sync.Mutex
+	knownGPUs     = make(map[gpuIdentity]bool)
+	gpuLost       float64
+)
+
+type gpuIdentity struct {
+	card, id string
+}
+
+// Users holding GPU resources, read by users.go. Guarded since it's a map
+var (
+	sharedGPUUsersMu sync.Mutex
+	sharedGPUUsers   map[string]struct{}
+)
+
+func getSharedGPUUsers() map[string]struct{} {
+	sharedGPUUsersMu.Lock()
+	defer sharedGPUUsersMu.Unlock()
+	return sharedGPUUsers
+}
+
+func NewGPUCollector() *GPUCollector {
+	return &GPUCollector{
+		gpuBusyPercentDesc: prometheus.NewDesc(
+			"syscore_gpu_busy_percent",
+			"Percentage GPU is busy.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuGTTSizeDesc: prometheus.NewDesc(
+			"syscore_gpu_gtt_size",
+			"Size of GTT block in bytes.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuGTTUsedDesc: prometheus.NewDesc(
+			"syscore_gpu_gtt_used",
+			"Used bytes of GTT block.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuVisibleVRAMSizeDesc: prometheus.NewDesc(
+			"syscore_gpu_visible_vram_size",
+			"Size of visible VRAM in bytes.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuVisibleVRAMUsedDesc: prometheus.NewDesc(
+			"syscore_gpu_visible_vram_used",
+			"Used bytes of visible VRAM.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuMemoryVRAMSizeDesc: prometheus.NewDesc(
+			"syscore_gpu_vram_size",
+			"Size of VRAM in bytes.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuMemoryVRAMUsedDesc: prometheus.NewDesc(
+			"syscore_gpu_vram_used",
+			"Used bytes of VRAM.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuPowerDesc: prometheus.NewDesc(
+			"syscore_gpu_power_watts",
+			"Average GPU power draw in watts.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuTemperatureDesc: prometheus.NewDesc(
+			"syscore_gpu_temperature_celsius",
+			"GPU temperature per sensor in degrees Celsius.",
+			[]string{"card", "id", "sensor"},
+			nil,
+		),
+		gpuSclkDesc: prometheus.NewDesc(
+			"syscore_gpu_sclk_hz",
+			"Current shader clock in hertz.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuMemBusyPercentDesc: prometheus.NewDesc(
+			"syscore_gpu_mem_busy_percent",
+			"Percentage memory bandwidth is busy.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuUtilDesc: prometheus.NewDesc(
+			"syscore_gpu_util",
+			"Per card utilization blend of busy, memory and GTT (0-100)",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuAverageUtilizationDesc: prometheus.NewDesc(
+			"syscore_gpu_avg_util",
+			"Average percentage of gpu utilization (0-100)",
+			nil,
+			nil,
+		),
+		gpuUtilAggregateDesc: prometheus.NewDesc(
+			"syscore_gpu_util_aggregate",
+			"GPU utilization across cards per aggregation mode (0-100), GPUUtilAggregation picks the one used in the score",
+			[]string{"mode"},
+			nil,
+		),
+		gpuECCErrorsDesc: prometheus.NewDesc(
+			"syscore_gpu_ecc_errors_total",
+			"ECC errors per RAS block.",
+			[]string{"card", "id", "block", "type"},
+			nil,
+		),
+		gpuPCIeSpeedDesc: prometheus.NewDesc(
+			"syscore_gpu_pcie_link_speed_gts",
+			"PCIe link speed in GT/s per lane.",
+			[]string{"card", "id", "link"},
+			nil,
+		),
+		gpuPCIeWidthDesc: prometheus.NewDesc(
+			"syscore_gpu_pcie_link_width",
+			"PCIe link width in lanes.",
+			[]string{"card", "id", "link"},
+			nil,
+		),
+		gpuThrottledDesc: prometheus.NewDesc(
+			"syscore_gpu_throttled",
+			"Whether the GPU is currently throttled for the given reason.",
+			[]string{"card", "id", "reason"},
+			nil,
+		),
+		gpuHealthyDesc: prometheus.NewDesc(
+			"syscore_gpu_healthy",
+			"0 if the GPU has uncorrectable ECC errors or a downtrained PCIe link.",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuNodeHealthyDesc: prometheus.NewDesc(
+			"syscore_gpu_node_healthy",
+			"0 if any GPU on the node is degraded",
+			nil,
+			nil,
+		),
+		gpuPresentDesc: prometheus.NewDesc(
+			"syscore_gpu_present",
+			"Whether a previously seen GPU is present on the last sample",
+			[]string{"card", "id"},
+			nil,
+		),
+		gpuLostDesc: prometheus.NewDesc(
+			"syscore_gpu_lost_total",
+			"Number of times a GPU disappeared (fell off the bus or was reset)",
+			nil,
+			nil,
+		),
+		gpuProcessVRAMDesc: prometheus.NewDesc(
+			"syscore_gpu_process_vram_bytes",
+			"VRAM held by a process (KFD or DRM fdinfo).",
+			[]string{"card", "user", "pid"},
+			nil,
+		),
+		gpuProcessEngineDesc: prometheus.NewDesc(
+			"syscore_gpu_process_engine_seconds_total",
+			"GPU engine busy time used by a process (DRM fdinfo).",
+			[]string{"card", "user", "pid", "engine"},
+			nil,
+		),
+		gpuUserVRAMDesc: prometheus.NewDesc(
+			"syscore_gpu_user_vram_bytes",
+			"VRAM held by all processes of a user.",
+			[]string{"card", "user"},
+			nil,
+		),
+		processReader: utility.NewGPUProcessReader("/proc", "/sys"),
+	}
+}
+
+func (gc *GPUCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(gc, ch)
+}
+
+func (gc *GPUCollector) Collect(ch chan<- prometheus.Metric) {
+	// A node that lost every GPU has no backend but still needs presence reported
+	var devices []utility.GPUDevice
+	if backend := utility.GetGPUBackend(); backend != nil {
+		var err error
+		devices, err = backend.Sample()
+		// A card falling off the bus usually fails the whole query but the other cards still
+		// report, so carry on with those. With nothing at all we can't tell a lost card from
+		// a failed query, so keep the last known presence
+		if err != nil && len(devices) == 0 {
+			gc.collectPresence(ch, nil, false)
+			// Don't let the score keep the last utilization while the query keeps failing
+			SharedGpuUtil = 0
+			SharedDegradedGPUs = 0
+			return
+		}
+	}
+	gc.collectPresence(ch, devices, true)
+	var cardUtils []cardUtil
+	var degraded int
+
+	// Export metrics for each card
+	for _, card := range devices {
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuBusyPercentDesc,
+			prometheus.GaugeValue,
+			card.BusyPercent,
+			card.Card, card.ID,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuMemoryVRAMSizeDesc,
+			prometheus.GaugeValue,
+			float64(card.VRAMSize),
+			card.Card, card.ID,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuMemoryVRAMUsedDesc,
+			prometheus.GaugeValue,
+			float64(card.VRAMUsed),
+			card.Card, card.ID,
+		)
+		// GTT and visible VRAM are AMD concepts, skip them for other vendors
+		if card.GTTSize > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuGTTSizeDesc,
+				prometheus.GaugeValue,
+				float64(card.GTTSize),
+				card.Card, card.ID,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuGTTUsedDesc,
+				prometheus.GaugeValue,
+				float64(card.GTTUsed),
+				card.Card, card.ID,
+			)
+		}
+		if card.VisibleVRAMSize > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuVisibleVRAMSizeDesc,
+				prometheus.GaugeValue,
+				float64(card.VisibleVRAMSize),
+				card.Card, card.ID,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuVisibleVRAMUsedDesc,
+				prometheus.GaugeValue,
+				float64(card.VisibleVRAMUsed),
+				card.Card, card.ID,
+			)
+		}
+		if !math.IsNaN(card.PowerWatts) {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuPowerDesc,
+				prometheus.GaugeValue,
+				card.PowerWatts,
+				card.Card, card.ID,
+			)
+		}
+		if !math.IsNaN(card.SclkHz) {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuSclkDesc,
+				prometheus.GaugeValue,
+				card.SclkHz,
+				card.Card, card.ID,
+			)
+		}
+		if !math.IsNaN(card.MemBusyPercent) {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuMemBusyPercentDesc,
+				prometheus.GaugeValue,
+				card.MemBusyPercent,
+				card.Card, card.ID,
+			)
+		}
+		for sensor, celsius := range card.Temperatures {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuTemperatureDesc,
+				prometheus.GaugeValue,
+				celsius,
+				card.Card, card.ID, sensor,
+			)
+		}
+
+		gc.collectHealth(ch, card)
+		if card.Degraded() {
+			degraded++
+		}
+
+		gpuUtil := cardUtilization(card)
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuUtilDesc,
+			prometheus.GaugeValue,
+			gpuUtil,
+			card.Card, card.ID,
+		)
+		cardUtils = append(cardUtils, cardUtil{card.Card, gpuUtil})
+	}
+
+	SharedDegradedGPUs = degraded
+	if len(cardUtils) == 0 {
+		SharedGpuUtil = 0
+		return
+	}
+
+	nodeHealthy := 1.0
+	if degraded > 0 {
+		nodeHealthy = 0.0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		gc.gpuNodeHealthyDesc,
+		prometheus.GaugeValue,
+		nodeHealthy,
+	)
+
+	gc.collectProcesses(ch)
+
+	aggregates := aggregateGPUUtil(cardUtils)
+	for mode, value := range aggregates {
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuUtilAggregateDesc,
+			prometheus.GaugeValue,
+			value,
+			mode,
+		)
+	}
+
+	// Save for use in score.go
+	gpuUtil, ok := aggregates[GPUUtilAggregation]
+	if !ok {
+		gpuUtil = aggregates["mean"]
+	}
+	SharedGpuUtil = gpuUtil / 100
+
+	ch <- prometheus.MustNewConstMetric(
+		gc.gpuAverageUtilizationDesc,
+		prometheus.GaugeValue,
+		aggregates["mean"],
+	)
+}
+
+// Utilization (0-100) of one card, kept with its name for the allocated mode
+type cardUtil struct {
+	card string
+	util float64
+}
+
+// aggregateGPUUtil folds per-card utilization into every aggregation mode
+func aggregateGPUUtil(cardUtils []cardUtil) map[string]float64 {
+	aggregates := make(map[string]float64)
+
+	var total, max float64
+	var busy int
+	for _, c := range cardUtils {
+		total += c.util
+		if c.util > max {
+			max = c.util
+		}
+		if c.util >= GPUBusyThreshold {
+			busy++
+		}
+	}
+	aggregates["mean"] = total / float64(len(cardUtils))
+	aggregates["max"] = max
+	aggregates["busy_fraction"] = float64(busy) / float64(len(cardUtils)) * 100
+
+	data := getSlurmData()
+	if data.state == "UNKNOWN" || data.gpuTotal == 0 {
+		return aggregates
+	}
+	aggregates["allocated"] = allocatedGPUUtil(cardUtils, data)
+	return aggregates
+}
+
+// allocatedGPUUtil is the mean utilization of the cards Slurm handed to jobs.
+// Slurm GPU index N is taken to be the Nth card by device number (card0, card1 or
+// nvidia0, nvidia1, ...), which is the order gres.conf AutoDetect and File=/dev/...[0-N]
+// produce. Without GresUsed indices (older Slurm) the busiest gpuAlloc cards stand in
+func allocatedGPUUtil(cardUtils []cardUtil, data slurmNodeData) float64 {
+	var utils []float64
+	if data.gpuIdxKnown {
+		sorted := append([]cardUtil(nil), cardUtils...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return cardNumber(sorted[i].card) < cardNumber(sorted[j].card)
+		})
+		for _, idx := range data.gpuAllocIdx {
+			if idx >= 0 && idx < len(sorted) {
+				utils = append(utils, sorted[idx].util)
+			}
+		}
+	} else {
+		allocated := min(data.gpuAlloc, len(cardUtils))
+		for _, c := range cardUtils {
+			utils = append(utils, c.util)
+		}
+		sort.Sort(sort.Reverse(sort.Float64Slice(utils)))
+		utils = utils[:max(allocated, 0)]
+	}
+
+	if len(utils) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, util := range utils {
+		sum += util
+	}
+	return sum / float64(len(utils))
+}
+
+// cardNumber is the trailing number of a card name ("card3", "nvidia3" -> 3)
+func cardNumber(card string) int {
+	n, err := strconv.Atoi(strings.TrimLeft(card, "abcdefghijklmnopqrstuvwxyz"))
+	if err != nil {
+		return math.MaxInt
+	}
+	return n
+}
+
+// collectHealth exports ECC, PCIe link and throttle state for one card
+func (gc *GPUCollector) collectHealth(ch chan<- prometheus.Metric, card utility.GPUDevice) {
+	for block, count := range card.ECCErrors {
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuECCErrorsDesc,
+			prometheus.CounterValue,
+			float64(count.Correctable),
+			card.Card, card.ID, block, "correctable",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuECCErrorsDesc,
+			prometheus.CounterValue,
+			float64(count.Uncorrectable),
+			card.Card, card.ID, block, "uncorrectable",
+		)
+	}
+
+	links := []struct {
+		link  string
+		speed float64
+		width int
+	}{
+		{"current", card.PCIe.CurrentSpeedGTs, card.PCIe.CurrentWidth},
+		{"max", card.PCIe.MaxSpeedGTs, card.PCIe.MaxWidth},
+	}
+	for _, l := range links {
+		if l.speed > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuPCIeSpeedDesc,
+				prometheus.GaugeValue,
+				l.speed,
+				card.Card, card.ID, l.link,
+			)
+		}
+		if l.width > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuPCIeWidthDesc,
+				prometheus.GaugeValue,
+				float64(l.width),
+				card.Card, card.ID, l.link,
+			)
+		}
+	}
+
+	for reason, throttled := range card.Throttle {
+		value := 0.0
+		if throttled {
+			value = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuThrottledDesc,
+			prometheus.GaugeValue,
+			value,
+			card.Card, card.ID, reason,
+		)
+	}
+
+	healthy := 1.0
+	if card.Degraded() {
+		healthy = 0.0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		gc.gpuHealthyDesc,
+		prometheus.GaugeValue,
+		healthy,
+		card.Card, card.ID,
+	)
+}
+
+// collectPresence tracks cards across samples so lost GPUs stay visible
+func (gc *GPUCollector) collectPresence(ch chan<- prometheus.Metric, devices []utility.GPUDevice, update bool) {
+	gpuPresenceMu.Lock()
+	defer gpuPresenceMu.Unlock()
+
+	if update {
+		current := make(map[gpuIdentity]struct{}, len(devices))
+		for _, card := range devices {
+			current[gpuIdentity{card.Card, card.ID}] = struct{}{}
+		}
+		for gpu, wasPresent := range knownGPUs {
+			if _, ok := current[gpu]; !ok && wasPresent {
+				gpuLost++
+				knownGPUs[gpu] = false
+			}
+		}
+		for gpu := range current {
+			knownGPUs[gpu] = true
+		}
+	}
+
+	for gpu, present := range knownGPUs {
+		value := 0.0
+		if present {
+			value = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuPresentDesc,
+			prometheus.GaugeValue,
+			value,
+			gpu.card, gpu.id,
+		)
+	}
+	if len(knownGPUs) > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuLostDesc,
+			prometheus.CounterValue,
+			gpuLost,
+		)
+	}
+}
+
+// collectProcesses attributes GPU usage to processes and users
+func (gc *GPUCollector) collectProcesses(ch chan<- prometheus.Metric) {
+	processes, err := gc.processReader.Read()
+	if err != nil {
+		return
+	}
+
+	type cardUser struct{ card, user string }
+	userVRAM := make(map[cardUser]uint64)
+	usernameUID := make(map[string]string)
+	gpuUsers := make(map[string]struct{})
+
+	for _, proc := range processes {
+		uid, _ := readUID(proc.PID)
+		if uid == "" {
+			continue // Process exited
+		}
+		username, ok := usernameUID[uid]
+		if !ok {
+			username = lookupUsername(uid)
+			usernameUID[uid] = username
+		}
+
+		var engineNs uint64
+		for _, ns := range proc.EngineNs {
+			engineNs += ns
+		}
+		if proc.VRAMBytes == 0 && engineNs == 0 {
+			continue
+		}
+		// Xorg, gdm and monitoring daemons hold the device too, they are still
+		// attributed below but don't make the node look shared
+		if !isSystemUID(uid) {
+			gpuUsers[username] = struct{}{}
+		}
+		userVRAM[cardUser{proc.Card, username}] += proc.VRAMBytes
+
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuProcessVRAMDesc,
+			prometheus.GaugeValue,
+			float64(proc.VRAMBytes),
+			proc.Card, username, proc.PID,
+		)
+		for engine, ns := range proc.EngineNs {
+			ch <- prometheus.MustNewConstMetric(
+				gc.gpuProcessEngineDesc,
+				prometheus.CounterValue,
+				float64(ns)/1e9,
+				proc.Card, username, proc.PID, engine,
+			)
+		}
+	}
+
+	for key, vram := range userVRAM {
+		ch <- prometheus.MustNewConstMetric(
+			gc.gpuUserVRAMDesc,
+			prometheus.GaugeValue,
+			float64(vram),
+			key.card, key.user,
+		)
+	}
+
+	sharedGPUUsersMu.Lock()
+	sharedGPUUsers = gpuUsers
+	sharedGPUUsersMu.Unlock()
+}
+
+// cardUtilization blends busy %, memory and GTT occupancy using the configured weights (0-100)
+func cardUtilization(card utility.GPUDevice) float64 {
+	// Memory term uses total VRAM for both used and size
+	var memory float64
+	if card.VRAMSize > 0 {
+		memory = float64(card.VRAMUsed) / float64(card.VRAMSize) * 100
+	}
+	// Bandwidth tracks memory-bound work better than how much VRAM a job reserved
+	if GPUMemoryUtilSource == "bandwidth" && !math.IsNaN(card.MemBusyPercent) {
+		memory = card.MemBusyPercent
+	}
+	var gtt float64
+	if card.GTTSize > 0 {
+		gtt = float64(card.GTTUsed) / float64(card.GTTSize) * 100
+	}
+
+	totalWeight := GPUUtilBusyWeight + GPUUtilMemoryWeight + GPUUtilGTTWeight
+	if totalWeight <= 0 {
+		return card.BusyPercent
+	}
+	return (GPUUtilBusyWeight*card.BusyPercent + GPUUtilMemoryWeight*memory + GPUUtilGTTWeight*gtt) / totalWeight
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amitch747/system-scorer/utility"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func resetGPUPresence(t *testing.T) {
+	t.Helper()
+	gpuPresenceMu.Lock()
+	knownGPUs = make(map[gpuIdentity]bool)
+	gpuLost = 0
+	gpuPresenceMu.Unlock()
+}
+
+func drain(collect func(chan<- prometheus.Metric)) {
+	ch := make(chan prometheus.Metric, 100)
+	collect(ch)
+	close(ch)
+	for range ch {
+	}
+}
+
+func TestGPUPresence(t *testing.T) {
+	resetGPUPresence(t)
+	gc := NewGPUCollector()
+	all := []utility.GPUDevice{{Card: "nvidia0", ID: "GPU-a"}, {Card: "nvidia1", ID: "GPU-b"}}
+
+	drain(func(ch chan<- prometheus.Metric) { gc.collectPresence(ch, all, true) })
+
+	// Failed query with no rows: nothing is known, nothing is counted as lost
+	drain(func(ch chan<- prometheus.Metric) { gc.collectPresence(ch, nil, false) })
+	if gpuLost != 0 {
+		t.Fatalf("gpuLost = %v after a failed query, want 0", gpuLost)
+	}
+
+	// Partial rows: only the missing card is lost
+	drain(func(ch chan<- prometheus.Metric) { gc.collectPresence(ch, all[:1], true) })
+	if gpuLost != 1 || knownGPUs[gpuIdentity{"nvidia1", "GPU-b"}] || !knownGPUs[gpuIdentity{"nvidia0", "GPU-a"}] {
+		t.Fatalf("gpuLost = %v, known = %v, want nvidia1 lost", gpuLost, knownGPUs)
+	}
+
+	// Still missing: not counted twice
+	drain(func(ch chan<- prometheus.Metric) { gc.collectPresence(ch, all[:1], true) })
+	if gpuLost != 1 {
+		t.Fatalf("gpuLost = %v, want 1", gpuLost)
+	}
+}
+
+// flakyBackend serves devices until failing is set, then fails detection and sampling outright
+type flakyBackend struct {
+	devices []utility.GPUDevice
+	failing bool
+}
+
+func (b *flakyBackend) Name() string { return "flaky" }
+
+func (b *flakyBackend) Detect() (int, error) {
+	if b.failing {
+		return 0, errors.New("exit status 15")
+	}
+	return len(b.devices), nil
+}
+
+func (b *flakyBackend) Sample() ([]utility.GPUDevice, error) {
+	if b.failing {
+		return nil, errors.New("exit status 15")
+	}
+	return b.devices, nil
+}
+
+// useGPUBackend makes backend the only one detected, re-detecting on every call
+func useGPUBackend(t *testing.T, backend utility.GPUBackend) {
+	t.Helper()
+	prevBackends, prevInterval := utility.GPUBackends, utility.GPURedetectInterval
+	utility.GPUBackends = []utility.GPUBackend{backend}
+	utility.GPURedetectInterval = 0
+	t.Cleanup(func() {
+		utility.GPUBackends = prevBackends
+		utility.GetGPUConfig()
+		utility.GPURedetectInterval = prevInterval
+	})
+}
+
+func TestGPUUtilResetAfterFailedSample(t *testing.T) {
+	resetGPUPresence(t)
+	backend := &flakyBackend{devices: []utility.GPUDevice{{
+		Card: "nvidia0", ID: "GPU-a", BusyPercent: 80, VRAMSize: 1 << 30, VRAMUsed: 1 << 29,
+		PCIe: utility.PCIeLink{CurrentWidth: 8, MaxWidth: 16},
+	}}}
+	useGPUBackend(t, backend)
+	gc := NewGPUCollector()
+
+	drain(gc.Collect)
+	if SharedGpuUtil == 0 || SharedDegradedGPUs != 1 {
+		t.Fatalf("SharedGpuUtil = %v, SharedDegradedGPUs = %d after a good sample", SharedGpuUtil, SharedDegradedGPUs)
+	}
+
+	// Detection keeps the failing backend, the score must not keep the old utilization
+	backend.failing = true
+	drain(gc.Collect)
+	if utility.GetGPUBackend() == nil {
+		t.Fatal("failing backend should be kept")
+	}
+	if SharedGpuUtil != 0 || SharedDegradedGPUs != 0 {
+		t.Errorf("SharedGpuUtil = %v, SharedDegradedGPUs = %d after a failed sample, want 0, 0", SharedGpuUtil, SharedDegradedGPUs)
+	}
+}
+
+func TestAllocatedGPUUtil(t *testing.T) {
+	// Listed out of device order, the way a lexical card glob returns them
+	cards := []cardUtil{{"card10", 5}, {"card0", 90}, {"card1", 10}, {"card2", 70}}
+
+	tests := []struct {
+		name string
+		data slurmNodeData
+		want float64
+	}{
+		// IDX 1 and 2 are card1 and card2, not the two busiest cards
+		{"indices", slurmNodeData{gpuAlloc: 2, gpuAllocIdx: []int{1, 2}, gpuIdxKnown: true}, 40},
+		// IDX 3 is card10, the 4th card by number
+		{"numeric order", slurmNodeData{gpuAlloc: 1, gpuAllocIdx: []int{3}, gpuIdxKnown: true}, 5},
+		{"nothing allocated", slurmNodeData{gpuIdxKnown: true}, 0},
+		{"index out of range", slurmNodeData{gpuAlloc: 1, gpuAllocIdx: []int{7}, gpuIdxKnown: true}, 0},
+		// Without indices the busiest cards stand in
+		{"busiest fallback", slurmNodeData{gpuAlloc: 2}, 80},
+		{"fallback over-allocated", slurmNodeData{gpuAlloc: 8}, 43.75},
+	}
+	for _, tt := range tests {
+		if got := allocatedGPUUtil(cards, tt.data); got != tt.want {
+			t.Errorf("%s: allocatedGPUUtil = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -13,10 +14,29 @@ import (
 
 type diskStats struct {
 	name         string
+	readsDone    uint64
+	sectorsRead  uint64
+	writesDone   uint64
+	sectorsWrite uint64
 	ioTime       uint64
 	weightedTime uint64
 }
 
+// Per device results of one interval
+type diskMetrics struct {
+	ioUtil     float64 // 0-1
+	pressure   float64 // 0-1
+	deviceType string
+	layer      utility.BlockLayer
+	readBps    float64
+	writeBps   float64
+	readIOPS   float64
+	writeIOPS  float64
+}
+
+// /proc/diskstats sectors are always 512 bytes regardless of the device
+const diskSectorSize = 512
+
 var (
 	// keep a slice of previous diskStats
 	prevDiskStats   []diskStats
@@ -24,21 +44,60 @@ var (
 )
 
 type ioCollector struct {
+	procPath, sysPath string
+
+	ioTimeDesc        *prometheus.Desc
+	ioPressureDesc    *prometheus.Desc
+	ioBytesDesc       *prometheus.Desc
+	ioOpsDesc         *prometheus.Desc
+	ioDeviceInfoDesc  *prometheus.Desc
 	maxIOTimeDesc     *prometheus.Desc
 	maxIOPressureDesc *prometheus.Desc
 }
 
 func NewIoCollector() *ioCollector {
 	return &ioCollector{
-		maxIOTimeDesc: prometheus.NewDesc(
+		procPath: "/proc",
+		sysPath:  "/sys",
+		ioTimeDesc: prometheus.NewDesc(
 			"syscore_io_time",
-			"15s interval of time spent doing IO",
+			"15s interval of time spent doing IO per device",
+			[]string{"device"},
+			nil,
+		),
+		ioPressureDesc: prometheus.NewDesc(
+			"syscore_io_pressure",
+			"15s interval of IO pressure per device (see readme)",
+			[]string{"device", "type"},
+			nil,
+		),
+		ioBytesDesc: prometheus.NewDesc(
+			"syscore_io_bytes_per_second",
+			"15s average throughput per device",
+			[]string{"device", "direction"},
+			nil,
+		),
+		ioOpsDesc: prometheus.NewDesc(
+			"syscore_io_ops_per_second",
+			"15s average completed IO operations per device",
+			[]string{"device", "direction"},
+			nil,
+		),
+		ioDeviceInfoDesc: prometheus.NewDesc(
+			"syscore_io_device_info",
+			"Block device stack info: friendly name (dm/name for LVM) and layer (physical or logical)",
+			[]string{"device", "name", "layer"},
+			nil,
+		),
+		maxIOTimeDesc: prometheus.NewDesc(
+			"syscore_io_time_max",
+			"15s interval of time spent doing IO on the busiest device",
 			nil,
 			nil,
 		),
 		maxIOPressureDesc: prometheus.NewDesc(
-			"syscore_io_pressure",
-			"15s interval of IO pressure (see readme)",
+			"syscore_io_pressure_max",
+			"15s interval of IO pressure on the most pressured device (see readme)",
 			nil,
 			nil,
 		),
@@ -50,15 +109,49 @@ func (ic *ioCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (ic *ioCollector) Collect(ch chan<- prometheus.Metric) {
-	currDiskStats, err := readDiskstats()
+	currDiskStats, err := readDiskstats(filepath.Join(ic.procPath, "diskstats"), ic.sysPath)
 	if err != nil {
 		return
 	}
 
 	// process disks
-	maxIoTime, maxIOPressure := calcDisk(prevDiskStats, currDiskStats)
+	deviceMetrics := calcDisk(prevDiskStats, currDiskStats, ic.sysPath, utility.GetBlockDeviceInfoMap())
+
+	var maxIoTime, maxIOPressure, scoreIoTime float64
+	for device, disk := range deviceMetrics {
+		maxIoTime = math.Max(maxIoTime, disk.ioUtil)
+		maxIOPressure = math.Max(maxIOPressure, disk.pressure)
+		if inScoreLayer(disk.layer) {
+			scoreIoTime = math.Max(scoreIoTime, disk.ioUtil)
+		}
 
-	SharedMaxIOTime = maxIoTime
+		ch <- prometheus.MustNewConstMetric(
+			ic.ioDeviceInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			device, disk.layer.Name, disk.layer.Layer,
+		)
+
+		// Export as percentages (0-100) for Prometheus
+		ch <- prometheus.MustNewConstMetric(
+			ic.ioTimeDesc,
+			prometheus.GaugeValue,
+			disk.ioUtil*100,
+			device,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ic.ioPressureDesc,
+			prometheus.GaugeValue,
+			disk.pressure*100,
+			device, disk.deviceType,
+		)
+		ch <- prometheus.MustNewConstMetric(ic.ioBytesDesc, prometheus.GaugeValue, disk.readBps, device, "read")
+		ch <- prometheus.MustNewConstMetric(ic.ioBytesDesc, prometheus.GaugeValue, disk.writeBps, device, "write")
+		ch <- prometheus.MustNewConstMetric(ic.ioOpsDesc, prometheus.GaugeValue, disk.readIOPS, device, "read")
+		ch <- prometheus.MustNewConstMetric(ic.ioOpsDesc, prometheus.GaugeValue, disk.writeIOPS, device, "write")
+	}
+
+	SharedMaxIOTime = scoreIoTime
 	// Export as percentages (0-100) for Prometheus
 	ch <- prometheus.MustNewConstMetric(
 		ic.maxIOTimeDesc,
@@ -75,8 +168,8 @@ func (ic *ioCollector) Collect(ch chan<- prometheus.Metric) {
 	prevDiskStats = currDiskStats
 }
 
-func readDiskstats() ([]diskStats, error) {
-	file, err := os.Open("/proc/diskstats")
+func readDiskstats(path, sysPath string) ([]diskStats, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return []diskStats{}, err
 	}
@@ -92,19 +185,27 @@ func readDiskstats() ([]diskStats, error) {
 		}
 
 		name := fields[2]
-		if strings.HasPrefix(name, "ram") ||
-			strings.HasPrefix(name, "loop") ||
-			strings.HasPrefix(name, "/") ||
-			// nasty
-			len(name) > 3 && (name[0] == 's' && name[3] >= '0' && name[3] <= '9') {
+		if !includeDiskDevice(name) {
+			continue
+		}
+		// Partitions would double count their disk
+		if utility.IsPartition(sysPath, name) {
 			continue
 		}
 
+		readsDone, _ := strconv.ParseUint(fields[3], 10, 64)
+		sectorsRead, _ := strconv.ParseUint(fields[5], 10, 64)
+		writesDone, _ := strconv.ParseUint(fields[7], 10, 64)
+		sectorsWrite, _ := strconv.ParseUint(fields[9], 10, 64)
 		ioTime, _ := strconv.ParseUint(fields[12], 10, 64)
 		weightedTime, _ := strconv.ParseUint(fields[13], 10, 64)
 
 		disks = append(disks, diskStats{
 			name:         name,
+			readsDone:    readsDone,
+			sectorsRead:  sectorsRead,
+			writesDone:   writesDone,
+			sectorsWrite: sectorsWrite,
 			ioTime:       ioTime,
 			weightedTime: weightedTime,
 		})
@@ -112,10 +213,32 @@ func readDiskstats() ([]diskStats, error) {
 	return disks, scanner.Err()
 }
 
+// inScoreLayer reports whether a device counts towards the score under IOScoreLayer
+func inScoreLayer(layer utility.BlockLayer) bool {
+	switch IOScoreLayer {
+	case "physical":
+		return layer.Layer == "physical"
+	case "logical":
+		// Members of an array or volume are represented by the device on top
+		return !layer.Held
+	default: // "all"
+		return true
+	}
+}
+
+func includeDiskDevice(name string) bool {
+	if DiskDeviceExclude != nil && DiskDeviceExclude.MatchString(name) {
+		return false
+	}
+	if DiskDeviceInclude != nil && !DiskDeviceInclude.MatchString(name) {
+		return false
+	}
+	return true
+}
+
 // Looking for bottlenecks
-func calcDisk(prev, curr []diskStats) (float64, float64) {
-	var maxIoUtil, maxPressure float64
-	blockDeviceInfoMap := utility.GetBlockDeviceInfoMap()
+func calcDisk(prev, curr []diskStats, sysPath string, blockDeviceInfoMap map[string]utility.BlockDeviceInfo) map[string]diskMetrics {
+	deviceMetrics := make(map[string]diskMetrics)
 
 	// To avoid nested for loops, store previous disk states in a map
 	prevMap := make(map[string]diskStats)
@@ -134,9 +257,6 @@ func calcDisk(prev, curr []diskStats) (float64, float64) {
 		if ioUtil > 1.0 {
 			ioUtil = 1.0 // Need to clamp to avoid jitter
 		}
-		if ioUtil > maxIoUtil {
-			maxIoUtil = ioUtil
-		}
 
 		deltaWeightedTime := currDisk.weightedTime - prevDisk.weightedTime
 
@@ -147,18 +267,26 @@ func calcDisk(prev, curr []diskStats) (float64, float64) {
 
 		// Check if name is rotational
 		var pressure float64
-		if base, ok := utility.MatchBaseDevice(currDisk.name, blockDeviceInfoMap); ok {
+		deviceType := "unknown"
+		if base, ok := utility.MatchBaseDevice(sysPath, currDisk.name, blockDeviceInfoMap); ok {
 			blockDevice := blockDeviceInfoMap[base]
+			deviceType = blockDevice.Type
 			pressure = ioPressure(avgQueueDepth, blockDevice.Type)
 		}
 
-		if pressure > maxPressure {
-			maxPressure = pressure
+		deviceMetrics[currDisk.name] = diskMetrics{
+			ioUtil:     ioUtil,
+			pressure:   pressure,
+			deviceType: deviceType,
+			layer:      utility.ReadBlockLayer(sysPath, currDisk.name),
+			readBps:    float64((currDisk.sectorsRead-prevDisk.sectorsRead)*diskSectorSize) / ScrapeInterval,
+			writeBps:   float64((currDisk.sectorsWrite-prevDisk.sectorsWrite)*diskSectorSize) / ScrapeInterval,
+			readIOPS:   float64(currDisk.readsDone-prevDisk.readsDone) / ScrapeInterval,
+			writeIOPS:  float64(currDisk.writesDone-prevDisk.writesDone) / ScrapeInterval,
 		}
-
 	}
 
-	return maxIoUtil, maxPressure
+	return deviceMetrics
 }
 
 func ioPressure(avgQueueDepth float64, deviceType string) float64 {
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadDiskstatsSkipsPartitionsAndExcluded(t *testing.T) {
+	dir := t.TempDir()
+	sys := filepath.Join(dir, "sys")
+	for _, part := range []string{"sda1", "nvme0n1p1", "md0p1"} {
+		if err := os.MkdirAll(filepath.Join(sys, "class/block", part), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sys, "class/block", part, "partition"), []byte("1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diskstats := filepath.Join(dir, "diskstats")
+	lines := "" +
+		"   8       0 sda 100 0 800 10 50 0 400 5 0 20 15 0 0 0 0\n" +
+		"   8       1 sda1 90 0 700 9 40 0 300 4 0 18 13 0 0 0 0\n" +
+		"  65     160 sdaa 1 0 8 1 1 0 8 1 0 2 2 0 0 0 0\n" +
+		" 259       0 nvme0n1 5 0 40 1 5 0 40 1 0 2 2 0 0 0 0\n" +
+		" 259       1 nvme0n1p1 5 0 40 1 5 0 40 1 0 2 2 0 0 0 0\n" +
+		"   9       0 md0 3 0 24 0 3 0 24 0 0 1 1 0 0 0 0\n" +
+		" 259       2 md0p1 3 0 24 0 3 0 24 0 0 1 1 0 0 0 0\n" +
+		" 253       0 dm-0 3 0 24 0 3 0 24 0 0 1 1 0 0 0 0\n" +
+		"   7       0 loop0 1 0 8 0 0 0 0 0 0 0 0 0 0 0 0\n" +
+		"   1       0 ram0 short line\n"
+	if err := os.WriteFile(diskstats, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	disks, err := readDiskstats(diskstats, sys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, disk := range disks {
+		names = append(names, disk.name)
+	}
+	want := []string{"sda", "sdaa", "nvme0n1", "md0", "dm-0"}
+	if len(names) != len(want) {
+		t.Fatalf("devices = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("devices = %v, want %v", names, want)
+		}
+	}
+
+	sda := disks[0]
+	if sda.readsDone != 100 || sda.sectorsRead != 800 || sda.writesDone != 50 || sda.sectorsWrite != 400 || sda.ioTime != 20 || sda.weightedTime != 15 {
+		t.Errorf("sda = %+v", sda)
+	}
+}
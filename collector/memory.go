@@ -4,30 +4,48 @@ import (
 	"bufio"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Sizes in kB except the HugePages_* page counts
 type memInfo struct {
 	memTotal, memAvailable, swapTotal, swapFree, commitLimit, commitAS uint64
+	cached, buffers, shmem, anonPages                                  uint64
+	hugePagesTotal, hugePagesFree, hugePageSize                        uint64
 }
 
 type memCollector struct {
-	memUsageDesc    *prometheus.Desc
-	memCommitDesc   *prometheus.Desc
-	memSwapUsedDesc *prometheus.Desc
-	memPressureDesc *prometheus.Desc
+	memUsageDesc     *prometheus.Desc
+	memCommitDesc    *prometheus.Desc
+	memSwapUsedDesc  *prometheus.Desc
+	memPressureDesc  *prometheus.Desc
+	memBytesDesc     *prometheus.Desc
+	memHugePagesDesc *prometheus.Desc
+	memNUMABytesDesc *prometheus.Desc
+	vmstatRateDesc   *prometheus.Desc
+	memReclaimDesc   *prometheus.Desc
 }
 
+// /proc/vmstat counters from the previous scrape
+var prevVMStat map[string]uint64
+
+// Rates at which each reclaim signal is considered ~63% saturated
+const (
+	majfaultScale     = 500.0   // major faults/s
+	pgscanDirectScale = 10000.0 // pages/s scanned by direct reclaim
+)
+
 var SharedMemUsed float64
 
 func NewMemCollector() *memCollector {
 	return &memCollector{
 		memUsageDesc: prometheus.NewDesc(
 			"syscore_mem_usage",
-			"Percentage of physical memory in use",
+			"Percentage of physical memory in use (definition set by MemUsedDefinition)",
 			nil,
 			nil,
 		),
@@ -45,10 +63,40 @@ func NewMemCollector() *memCollector {
 		),
 		memPressureDesc: prometheus.NewDesc(
 			"syscore_mem_pressure",
-			"[Experimental] Weighted memory pressure index (usage + swap + commit)",
+			"[Experimental] Weighted memory pressure index (usage + swap + commit + reclaim)",
+			nil,
+			nil,
+		),
+		memBytesDesc: prometheus.NewDesc(
+			"syscore_mem_bytes",
+			"Memory from /proc/meminfo in bytes",
+			[]string{"type"},
+			nil,
+		),
+		memHugePagesDesc: prometheus.NewDesc(
+			"syscore_mem_hugepages",
+			"Number of persistent huge pages",
+			[]string{"state"},
+			nil,
+		),
+		vmstatRateDesc: prometheus.NewDesc(
+			"syscore_mem_vmstat_rate",
+			"15s per second rate of reclaim related /proc/vmstat counters",
+			[]string{"counter"},
+			nil,
+		),
+		memReclaimDesc: prometheus.NewDesc(
+			"syscore_mem_reclaim_pressure",
+			"Reclaim pressure from major faults, direct reclaim scans and OOM kills (0-1)",
 			nil,
 			nil,
 		),
+		memNUMABytesDesc: prometheus.NewDesc(
+			"syscore_mem_numa_bytes",
+			"Per NUMA node memory in bytes",
+			[]string{"node", "type"},
+			nil,
+		),
 	}
 }
 
@@ -61,12 +109,11 @@ func (mc *memCollector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		return
 	}
+	mc.collectBreakdown(ch, mInfo)
+	mc.collectNUMA(ch, mInfo.hugePageSize)
+
 	// Collect memUsage
-	var memUsed float64
-	// Make sure denominators not zero
-	if mInfo.memTotal > 0 {
-		memUsed = float64(mInfo.memTotal-mInfo.memAvailable) / float64(mInfo.memTotal)
-	}
+	memUsed := calcMemUsed(mInfo, MemUsedDefinition)
 	// Save for use in score.go
 	SharedMemUsed = memUsed
 
@@ -96,12 +143,18 @@ func (mc *memCollector) Collect(ch chan<- prometheus.Metric) {
 		memSwap*100,
 	)
 
+	// Kernel reclaim signals, the part of the index that reflects actual thrashing
+	reclaim := mc.collectReclaim(ch)
+
 	// nonlinear scaling (high commitRatio is very bad)
 	scaledMem := math.Pow(memUsed, 1.5)
 	scaledCommit := math.Pow(memCommit, 2.5)
 	scaledSwap := math.Pow(memSwap, 2.0)
-	// Saturating exponential. Needs tweaking
-	memPressure := 1 - math.Exp(-3*(0.7*scaledMem+0.2*scaledCommit+0.1*scaledSwap))
+	// Saturating exponential
+	memPressure := 1 - math.Exp(-MemPressureSteepness*(MemPressureUsageWeight*scaledMem+
+		MemPressureCommitWeight*scaledCommit+
+		MemPressureSwapWeight*scaledSwap+
+		MemPressureReclaimWeight*reclaim))
 
 	ch <- prometheus.MustNewConstMetric(
 		mc.memPressureDesc,
@@ -110,6 +163,221 @@ func (mc *memCollector) Collect(ch chan<- prometheus.Metric) {
 	)
 }
 
+// collectReclaim exports vmstat rates and returns the combined reclaim signal (0-1)
+func (mc *memCollector) collectReclaim(ch chan<- prometheus.Metric) float64 {
+	curr, err := readVMStat()
+	if err != nil {
+		return 0
+	}
+	prev := prevVMStat
+	prevVMStat = curr
+	if prev == nil {
+		return 0
+	}
+
+	rates := make(map[string]float64)
+	for counter, value := range curr {
+		if value < prev[counter] {
+			continue
+		}
+		rates[counter] = float64(value-prev[counter]) / ScrapeInterval
+		ch <- prometheus.MustNewConstMetric(
+			mc.vmstatRateDesc,
+			prometheus.GaugeValue,
+			rates[counter],
+			counter,
+		)
+	}
+
+	// Any OOM kill means the node ran out, otherwise take the worse of faults and scans
+	reclaim := math.Max(
+		1-math.Exp(-rates["pgmajfault"]/majfaultScale),
+		1-math.Exp(-rates["pgscan_direct"]/pgscanDirectScale),
+	)
+	if rates["oom_kill"] > 0 {
+		reclaim = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		mc.memReclaimDesc,
+		prometheus.GaugeValue,
+		reclaim,
+	)
+	return reclaim
+}
+
+// readVMStat reads pgmajfault, pgscan_direct and oom_kill from /proc/vmstat
+func readVMStat() (map[string]uint64, error) {
+	file, err := os.Open("/proc/vmstat")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	counters := make(map[string]uint64)
+	var zoneScans uint64
+	var hasTotalScan bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		val, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch {
+		case fields[0] == "pgmajfault", fields[0] == "oom_kill":
+			counters[fields[0]] = val
+		case fields[0] == "pgscan_direct":
+			counters["pgscan_direct"] = val
+			hasTotalScan = true
+		case fields[0] == "pgscan_direct_throttle":
+			continue
+		case strings.HasPrefix(fields[0], "pgscan_direct_"):
+			// Older kernels only have per zone counters
+			zoneScans += val
+		}
+	}
+	if !hasTotalScan {
+		counters["pgscan_direct"] = zoneScans
+	}
+	return counters, scanner.Err()
+}
+
+// calcMemUsed returns used memory (0-1) under one of the MemUsedDefinition modes
+func calcMemUsed(m memInfo, definition string) float64 {
+	// Make sure denominators not zero
+	if m.memTotal == 0 {
+		return 0
+	}
+	hugeUsed := (m.hugePagesTotal - m.hugePagesFree) * m.hugePageSize
+	hugeFree := m.hugePagesFree * m.hugePageSize
+
+	var used float64
+	switch definition {
+	case "anon":
+		// What processes actually hold, ignoring reclaimable cache
+		used = float64(m.anonPages + m.shmem + hugeUsed)
+	case "slurm":
+		// Memory promised to jobs, whether or not they touch it
+		data := getSlurmData()
+		if data.memRealMB > 0 {
+			ratio := float64(data.memAllocMB) / float64(data.memRealMB)
+			return math.Min(ratio, 1.0)
+		}
+		used = float64(m.memTotal - m.memAvailable)
+	case "hugepages":
+		// MemAvailable treats the whole hugepage pool as used, give back the free pages
+		if m.memTotal-m.memAvailable < hugeFree {
+			return 0
+		}
+		used = float64(m.memTotal - m.memAvailable - hugeFree)
+	default: // "available"
+		used = float64(m.memTotal - m.memAvailable)
+	}
+
+	ratio := used / float64(m.memTotal)
+	if ratio > 1.0 {
+		ratio = 1.0
+	}
+	return ratio
+}
+
+func (mc *memCollector) collectBreakdown(ch chan<- prometheus.Metric, m memInfo) {
+	breakdown := map[string]uint64{
+		"total":     m.memTotal,
+		"available": m.memAvailable,
+		"cached":    m.cached,
+		"buffers":   m.buffers,
+		"shmem":     m.shmem,
+		"anon":      m.anonPages,
+	}
+	for memType, kB := range breakdown {
+		ch <- prometheus.MustNewConstMetric(
+			mc.memBytesDesc,
+			prometheus.GaugeValue,
+			float64(kB*1024),
+			memType,
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		mc.memHugePagesDesc,
+		prometheus.GaugeValue,
+		float64(m.hugePagesTotal),
+		"total",
+	)
+	ch <- prometheus.MustNewConstMetric(
+		mc.memHugePagesDesc,
+		prometheus.GaugeValue,
+		float64(m.hugePagesFree),
+		"free",
+	)
+}
+
+// collectNUMA exports /sys/devices/system/node/node*/meminfo
+func (mc *memCollector) collectNUMA(ch chan<- prometheus.Metric, hugePageSize uint64) {
+	nodeDirs, _ := filepath.Glob("/sys/devices/system/node/node[0-9]*")
+	for _, dir := range nodeDirs {
+		node := strings.TrimPrefix(filepath.Base(dir), "node")
+		m, err := readNodeMemInfo(filepath.Join(dir, "meminfo"), hugePageSize)
+		if err != nil {
+			continue
+		}
+		for memType, value := range m {
+			ch <- prometheus.MustNewConstMetric(
+				mc.memNUMABytesDesc,
+				prometheus.GaugeValue,
+				value,
+				node, memType,
+			)
+		}
+	}
+}
+
+// Fields exported per NUMA node, meminfo name -> type label
+var numaMemFields = map[string]string{
+	"MemTotal:":  "total",
+	"MemFree:":   "free",
+	"MemUsed:":   "used",
+	"FilePages:": "file",
+	"AnonPages:": "anon",
+	"Shmem:":     "shmem",
+}
+
+// readNodeMemInfo parses lines like "Node 0 MemTotal:  16384 kB".
+// Node meminfo has no page size, so the system default (kB) is passed in
+func readNodeMemInfo(path string, hugePageSize uint64) (map[string]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]float64)
+	var hugeTotal, hugeFree float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		val, _ := strconv.ParseFloat(fields[3], 64)
+		switch fields[2] {
+		case "HugePages_Total:":
+			hugeTotal = val
+		case "HugePages_Free:":
+			hugeFree = val
+		default:
+			if memType, ok := numaMemFields[fields[2]]; ok {
+				values[memType] = val * 1024
+			}
+		}
+	}
+	hugeSize := float64(hugePageSize * 1024)
+	values["hugepages_total"] = hugeTotal * hugeSize
+	values["hugepages_free"] = hugeFree * hugeSize
+	return values, scanner.Err()
+}
+
 func readMemInfo() (memInfo, error) {
 	file, err := os.Open("/proc/meminfo")
 	if err != nil {
@@ -139,6 +407,20 @@ func readMemInfo() (memInfo, error) {
 			m.commitLimit = val
 		case "Committed_AS:":
 			m.commitAS = val
+		case "Cached:":
+			m.cached = val
+		case "Buffers:":
+			m.buffers = val
+		case "Shmem:":
+			m.shmem = val
+		case "AnonPages:":
+			m.anonPages = val
+		case "HugePages_Total:":
+			m.hugePagesTotal = val
+		case "HugePages_Free:":
+			m.hugePagesFree = val
+		case "Hugepagesize:":
+			m.hugePageSize = val
 		}
 	}
 	return m, scanner.Err()
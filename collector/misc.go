@@ -2,5 +2,4 @@ package collector
 
 /*
 	- User processes (maybe add to user.go)
-	- Power draw
 */
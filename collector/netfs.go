@@ -0,0 +1,310 @@
+package collector
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amitch747/system-scorer/utility"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// Network filesystem IO. NFS comes from /proc/self/mountstats and Lustre from the llite stats files,
+// neither of which shows up in /proc/diskstats
+
+// Lustre moved llite stats to debugfs in 2.12
+var lustreStatsGlobs = []string{
+	"/proc/fs/lustre/llite/*/stats",
+	"/sys/kernel/debug/lustre/llite/*/stats",
+}
+
+type netfsOpStats struct {
+	requests  uint64
+	latencyMs float64 // Cumulative RTT (NFS) or op time (Lustre)
+}
+
+type netfsStats struct {
+	mount      string
+	fsType     string
+	readBytes  uint64
+	writeBytes uint64
+	ops        uint64
+	perOp      map[string]netfsOpStats
+}
+
+// Per mount results of one interval
+type netfsMetrics struct {
+	fsType    string
+	readBps   float64
+	writeBps  float64
+	opsPerSec float64
+	latency   map[string]float64 // Average seconds per op
+	util      float64            // 0-1, throughput over NetFSBandwidth
+}
+
+var (
+	prevNetFSStats     map[string]netfsStats
+	SharedMaxNetFSUtil float64 // Used in score.go when ScoreIOIncludeNetFS is set
+)
+
+type netfsCollector struct {
+	bytesDesc   *prometheus.Desc
+	opsDesc     *prometheus.Desc
+	latencyDesc *prometheus.Desc
+	utilDesc    *prometheus.Desc
+}
+
+func NewNetFSCollector() *netfsCollector {
+	return &netfsCollector{
+		bytesDesc: prometheus.NewDesc(
+			"syscore_netfs_bytes_per_second",
+			"15s average throughput to/from the server per network filesystem mount",
+			[]string{"mount", "fstype", "direction"},
+			nil,
+		),
+		opsDesc: prometheus.NewDesc(
+			"syscore_netfs_ops_per_second",
+			"15s average operations per network filesystem mount",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+		latencyDesc: prometheus.NewDesc(
+			"syscore_netfs_latency_seconds",
+			"15s average latency per operation (NFS server round trip time, Lustre op time when the client reports it)",
+			[]string{"mount", "fstype", "op"},
+			nil,
+		),
+		utilDesc: prometheus.NewDesc(
+			"syscore_netfs_util",
+			"15s throughput per network filesystem mount over the reference bandwidth (0-100)",
+			[]string{"mount", "fstype"},
+			nil,
+		),
+	}
+}
+
+func (nc *netfsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(nc, ch)
+}
+
+func (nc *netfsCollector) Collect(ch chan<- prometheus.Metric) {
+	currStats := readNFSStats()
+	for key, stats := range readLustreStats() {
+		currStats[key] = stats
+	}
+
+	mountMetrics := calcNetFS(prevNetFSStats, currStats, netfsBandwidth())
+	prevNetFSStats = currStats
+
+	var maxUtil float64
+	for mount, m := range mountMetrics {
+		maxUtil = math.Max(maxUtil, m.util)
+
+		ch <- prometheus.MustNewConstMetric(nc.bytesDesc, prometheus.GaugeValue, m.readBps, mount, m.fsType, "read")
+		ch <- prometheus.MustNewConstMetric(nc.bytesDesc, prometheus.GaugeValue, m.writeBps, mount, m.fsType, "write")
+		ch <- prometheus.MustNewConstMetric(nc.opsDesc, prometheus.GaugeValue, m.opsPerSec, mount, m.fsType)
+		// Export as percentages (0-100) for Prometheus
+		ch <- prometheus.MustNewConstMetric(nc.utilDesc, prometheus.GaugeValue, m.util*100, mount, m.fsType)
+		for op, seconds := range m.latency {
+			ch <- prometheus.MustNewConstMetric(nc.latencyDesc, prometheus.GaugeValue, seconds, mount, m.fsType, op)
+		}
+	}
+	SharedMaxNetFSUtil = maxUtil
+}
+
+// netfsBandwidth is the configured reference bandwidth, or the fastest link when unset
+func netfsBandwidth() float64 {
+	if NetFSBandwidth > 0 {
+		return NetFSBandwidth
+	}
+	var fastest int64
+	for device, speed := range utility.GetLinkSpeeds() {
+		if NetDeviceFilter.MatchString(device) {
+			continue
+		}
+		if speed > fastest {
+			fastest = speed
+		}
+	}
+	return float64(fastest)
+}
+
+func readNFSStats() map[string]netfsStats {
+	stats := make(map[string]netfsStats)
+
+	self, err := procfs.Self()
+	if err != nil {
+		return stats
+	}
+	mounts, err := self.MountStats()
+	if err != nil {
+		return stats
+	}
+
+	for _, mount := range mounts {
+		nfs, ok := mount.Stats.(*procfs.MountStatsNFS)
+		if !ok {
+			continue
+		}
+
+		s := netfsStats{
+			mount:      mount.Mount,
+			fsType:     mount.Type,
+			readBytes:  nfs.Bytes.ReadTotal,
+			writeBytes: nfs.Bytes.WriteTotal,
+			perOp:      make(map[string]netfsOpStats),
+		}
+		for _, op := range nfs.Operations {
+			if op.Requests == 0 {
+				continue // Skip the dozens of ops this mount never used
+			}
+			s.ops += op.Requests
+			s.perOp[op.Operation] = netfsOpStats{
+				requests:  op.Requests,
+				latencyMs: float64(op.CumulativeTotalResponseMilliseconds), // RTT, without client queueing
+			}
+		}
+		stats[mount.Mount] = s
+	}
+	return stats
+}
+
+func readLustreStats() map[string]netfsStats {
+	stats := make(map[string]netfsStats)
+	mountpoints := lustreMountpoints()
+
+	for _, pattern := range lustreStatsGlobs {
+		files, _ := filepath.Glob(pattern)
+		for _, file := range files {
+			// Instance dirs are <fsname>-<superblock address>
+			instance := filepath.Base(filepath.Dir(file))
+			fsName := instance
+			if i := strings.LastIndex(instance, "-"); i > 0 {
+				fsName = instance[:i]
+			}
+			mount, ok := mountpoints[fsName]
+			if !ok {
+				mount = fsName
+			}
+			if _, seen := stats[mount]; seen {
+				continue
+			}
+
+			s, err := parseLustreStats(file)
+			if err != nil {
+				continue
+			}
+			s.mount = mount
+			stats[mount] = s
+		}
+	}
+	return stats
+}
+
+// lustreMountpoints maps fsname to mountpoint using the mount source (mgsnode@tcp:/fsname)
+func lustreMountpoints() map[string]string {
+	mountpoints := make(map[string]string)
+	mounts, err := procfs.GetMounts()
+	if err != nil {
+		return mountpoints
+	}
+	for _, mount := range mounts {
+		if mount.FSType != "lustre" {
+			continue
+		}
+		if i := strings.LastIndex(mount.Source, ":/"); i >= 0 {
+			mountpoints[mount.Source[i+2:]] = mount.MountPoint
+		}
+	}
+	return mountpoints
+}
+
+// parseLustreStats reads lines like "read_bytes 12 samples [bytes] 4096 1048576 123456789"
+func parseLustreStats(path string) (netfsStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return netfsStats{}, err
+	}
+	defer file.Close()
+
+	s := netfsStats{
+		fsType: "lustre",
+		perOp:  make(map[string]netfsOpStats),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] != "samples" {
+			continue // snapshot_time and friends
+		}
+		samples, _ := strconv.ParseUint(fields[1], 10, 64)
+
+		var sum uint64
+		if len(fields) >= 7 {
+			sum, _ = strconv.ParseUint(fields[6], 10, 64)
+		}
+
+		// read/write show up both as [bytes] and, on newer clients, as [usecs]. Count them once
+		switch name, unit := fields[0], fields[3]; {
+		case name == "read_bytes":
+			s.readBytes = sum
+			s.ops += samples
+		case name == "write_bytes":
+			s.writeBytes = sum
+			s.ops += samples
+		case unit == "[usecs]":
+			if name != "read" && name != "write" {
+				s.ops += samples
+			}
+			s.perOp[name] = netfsOpStats{requests: samples, latencyMs: float64(sum) / 1000}
+		default:
+			s.ops += samples
+		}
+	}
+	return s, scanner.Err()
+}
+
+func calcNetFS(prev, curr map[string]netfsStats, bandwidth float64) map[string]netfsMetrics {
+	mountMetrics := make(map[string]netfsMetrics)
+
+	for mount, currStats := range curr {
+		prevStats, ok := prev[mount]
+		// Counters reset on remount
+		if !ok || currStats.readBytes < prevStats.readBytes || currStats.writeBytes < prevStats.writeBytes || currStats.ops < prevStats.ops {
+			continue
+		}
+
+		readBps := float64(currStats.readBytes-prevStats.readBytes) / ScrapeInterval
+		writeBps := float64(currStats.writeBytes-prevStats.writeBytes) / ScrapeInterval
+
+		latency := make(map[string]float64)
+		for op, currOp := range currStats.perOp {
+			prevOp := prevStats.perOp[op]
+			if currOp.requests <= prevOp.requests {
+				latency[op] = 0
+				continue
+			}
+			latency[op] = (currOp.latencyMs - prevOp.latencyMs) / 1000 / float64(currOp.requests-prevOp.requests)
+		}
+
+		var util float64
+		if bandwidth > 0 {
+			// Reads and writes travel in opposite directions on a full duplex link, so the busier one bounds it
+			util = math.Min(math.Max(readBps, writeBps)/bandwidth, 1.0)
+		}
+
+		mountMetrics[mount] = netfsMetrics{
+			fsType:    currStats.fsType,
+			readBps:   readBps,
+			writeBps:  writeBps,
+			opsPerSec: float64(currStats.ops-prevStats.ops) / ScrapeInterval,
+			latency:   latency,
+			util:      util,
+		}
+	}
+	return mountMetrics
+}
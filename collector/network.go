@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"math"
+
 	"github.com/amitch747/system-scorer/utility"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs"
@@ -8,6 +10,9 @@ import (
 
 type networkCollector struct {
 	netSaturationDesc      *prometheus.Desc
+	netDirSaturationDesc   *prometheus.Desc
+	netBytesDesc           *prometheus.Desc
+	netPacketsDesc         *prometheus.Desc
 	netDropPercentageDesc  *prometheus.Desc
 	netErrorPercentageDesc *prometheus.Desc
 }
@@ -18,10 +23,28 @@ func NewNetworkCollector() *networkCollector {
 	return &networkCollector{
 		netSaturationDesc: prometheus.NewDesc(
 			"syscore_net_saturation_percentage",
-			"15s percentage of throughput over link capacity",
+			"15s percentage of throughput over link capacity in the busier direction",
 			[]string{"device"},
 			nil,
 		),
+		netDirSaturationDesc: prometheus.NewDesc(
+			"syscore_net_direction_saturation_percentage",
+			"15s percentage of throughput over link capacity per direction",
+			[]string{"device", "direction"},
+			nil,
+		),
+		netBytesDesc: prometheus.NewDesc(
+			"syscore_net_bytes_per_second",
+			"15s average throughput per device",
+			[]string{"device", "direction"},
+			nil,
+		),
+		netPacketsDesc: prometheus.NewDesc(
+			"syscore_net_packets_per_second",
+			"15s average packet rate per device",
+			[]string{"device", "direction"},
+			nil,
+		),
 		netDropPercentageDesc: prometheus.NewDesc(
 			"syscore_net_drop_percentage",
 			"15s percentage of packets dropped over total packets",
@@ -47,7 +70,12 @@ type networkStats struct {
 }
 
 type networkMetrics struct {
-	saturationPercentage float64
+	hasLinkSpeed         bool
+	saturationPercentage float64 // max(rx, tx), links are full duplex
+	rxSaturation         float64
+	txSaturation         float64
+	rxBps, txBps         float64
+	rxPps, txPps         float64
 	dropPercentage       float64
 	errsPercentage       float64
 }
@@ -77,12 +105,20 @@ func (nc *networkCollector) Collect(ch chan<- prometheus.Metric) {
 		}
 
 		// Export as percentages (0-100) for Prometheus
-		ch <- prometheus.MustNewConstMetric(
-			nc.netSaturationDesc,
-			prometheus.GaugeValue,
-			device.saturationPercentage*100,
-			deviceName,
-		)
+		if device.hasLinkSpeed {
+			ch <- prometheus.MustNewConstMetric(
+				nc.netSaturationDesc,
+				prometheus.GaugeValue,
+				device.saturationPercentage*100,
+				deviceName,
+			)
+			ch <- prometheus.MustNewConstMetric(nc.netDirSaturationDesc, prometheus.GaugeValue, device.rxSaturation*100, deviceName, "rx")
+			ch <- prometheus.MustNewConstMetric(nc.netDirSaturationDesc, prometheus.GaugeValue, device.txSaturation*100, deviceName, "tx")
+		}
+		ch <- prometheus.MustNewConstMetric(nc.netBytesDesc, prometheus.GaugeValue, device.rxBps, deviceName, "rx")
+		ch <- prometheus.MustNewConstMetric(nc.netBytesDesc, prometheus.GaugeValue, device.txBps, deviceName, "tx")
+		ch <- prometheus.MustNewConstMetric(nc.netPacketsDesc, prometheus.GaugeValue, device.rxPps, deviceName, "rx")
+		ch <- prometheus.MustNewConstMetric(nc.netPacketsDesc, prometheus.GaugeValue, device.txPps, deviceName, "tx")
 		ch <- prometheus.MustNewConstMetric(
 			nc.netDropPercentageDesc,
 			prometheus.GaugeValue,
@@ -149,19 +185,20 @@ func calcNetworkMetrics(stats map[string]networkStats, linkSpeeds map[string]int
 			continue
 		}
 
-		// Get link speed
-		linkSpeed, ok := linkSpeeds[deviceName]
-		if !ok || linkSpeed == 0 {
-			continue
+		rxBps := float64(netStats.bytesReceive-prevNetStats.bytesReceive) / ScrapeInterval
+		txBps := float64(netStats.bytesTransmit-prevNetStats.bytesTransmit) / ScrapeInterval
+
+		// Calculate saturation per direction (return as 0-1 for internal use)
+		// Link speed is per direction on full duplex links, so Rx and Tx can't be summed
+		// Virtual NICs report no speed, they still get throughput but no saturation
+		linkSpeed := linkSpeeds[deviceName]
+		hasLinkSpeed := linkSpeed > 0
+		var rxSaturation, txSaturation float64
+		if hasLinkSpeed {
+			rxSaturation = rxBps / float64(linkSpeed)
+			txSaturation = txBps / float64(linkSpeed)
 		}
 
-		// Calculate saturation (return as 0-1 for internal use)
-		deltaRxBytes := netStats.bytesReceive - prevNetStats.bytesReceive
-		deltaTxBytes := netStats.bytesTransmit - prevNetStats.bytesTransmit
-		totalBytes := deltaRxBytes + deltaTxBytes
-		throughputBps := float64(totalBytes) / ScrapeInterval
-		saturationPercentage := float64(throughputBps) / float64(linkSpeed)
-
 		deltaRxPackets := netStats.packetsReceive - prevNetStats.packetsReceive
 		deltaTxPackets := netStats.packetsTransmit - prevNetStats.packetsTransmit
 		totalPackets := float64(deltaRxPackets + deltaTxPackets)
@@ -183,7 +220,14 @@ func calcNetworkMetrics(stats map[string]networkStats, linkSpeeds map[string]int
 		}
 
 		deviceMetrics[deviceName] = networkMetrics{
-			saturationPercentage: saturationPercentage,
+			hasLinkSpeed:         hasLinkSpeed,
+			saturationPercentage: math.Max(rxSaturation, txSaturation),
+			rxSaturation:         rxSaturation,
+			txSaturation:         txSaturation,
+			rxBps:                rxBps,
+			txBps:                txBps,
+			rxPps:                float64(deltaRxPackets) / ScrapeInterval,
+			txPps:                float64(deltaTxPackets) / ScrapeInterval,
 			dropPercentage:       dropPercentage,
 			errsPercentage:       errPercentage,
 		}
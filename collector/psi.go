@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// Pressure Stall Information from /proc/pressure (kernel 4.20+, CONFIG_PSI)
+
+type psiCollector struct {
+	psiAvgDesc   *prometheus.Desc
+	psiTotalDesc *prometheus.Desc
+}
+
+var psiResources = []string{"cpu", "memory", "io"}
+
+// "some" avg10 as 0-1, used in score.go when PSI inputs are enabled
+var (
+	SharedPSICPU       float64
+	SharedPSIMemory    float64
+	SharedPSIIO        float64
+	SharedPSIAvailable bool
+)
+
+func NewPSICollector() *psiCollector {
+	return &psiCollector{
+		psiAvgDesc: prometheus.NewDesc(
+			"syscore_psi_avg",
+			"Percentage of time tasks were stalled on a resource, averaged over the window (0-100)",
+			[]string{"resource", "type", "window"},
+			nil,
+		),
+		psiTotalDesc: prometheus.NewDesc(
+			"syscore_psi_stall_seconds_total",
+			"Total time tasks were stalled on a resource",
+			[]string{"resource", "type"},
+			nil,
+		),
+	}
+}
+
+func (pc *psiCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(pc, ch)
+}
+
+func (pc *psiCollector) Collect(ch chan<- prometheus.Metric) {
+	fs, err := procfs.NewFS("/proc")
+	if err != nil {
+		SharedPSIAvailable = false
+		return
+	}
+
+	available := false
+	for _, resource := range psiResources {
+		stats, err := fs.PSIStatsForResource(resource)
+		if err != nil {
+			continue
+		}
+		available = true
+
+		pc.collectLine(ch, resource, "some", stats.Some)
+		// CPU "full" is all zeros at the system level on most kernels but still reported
+		pc.collectLine(ch, resource, "full", stats.Full)
+
+		if stats.Some == nil {
+			continue
+		}
+		switch resource {
+		case "cpu":
+			SharedPSICPU = stats.Some.Avg10 / 100
+		case "memory":
+			SharedPSIMemory = stats.Some.Avg10 / 100
+		case "io":
+			SharedPSIIO = stats.Some.Avg10 / 100
+		}
+	}
+	SharedPSIAvailable = available
+}
+
+func (pc *psiCollector) collectLine(ch chan<- prometheus.Metric, resource, psiType string, line *procfs.PSILine) {
+	if line == nil {
+		return
+	}
+	windows := map[string]float64{
+		"10s":  line.Avg10,
+		"60s":  line.Avg60,
+		"300s": line.Avg300,
+	}
+	for window, avg := range windows {
+		ch <- prometheus.MustNewConstMetric(
+			pc.psiAvgDesc,
+			prometheus.GaugeValue,
+			avg,
+			resource, psiType, window,
+		)
+	}
+	// Total is in microseconds
+	ch <- prometheus.MustNewConstMetric(
+		pc.psiTotalDesc,
+		prometheus.CounterValue,
+		float64(line.Total)/1e6,
+		resource, psiType,
+	)
+}
@@ -2,12 +2,24 @@ package collector
 
 import (
 	"math"
-	"runtime"
+	"sync/atomic"
 
 	"github.com/amitch747/system-scorer/utility"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Latest weighted score, used by slurm_update.go. Nil until the first scrape
+var sharedWeightedScore atomic.Pointer[float64]
+
+// latestWeightedScore returns the last computed score and whether a scrape has produced one yet
+func latestWeightedScore() (float64, bool) {
+	score := sharedWeightedScore.Load()
+	if score == nil {
+		return 0, false
+	}
+	return *score, true
+}
+
 type scoreCollector struct {
 	weightedScoreDesc *prometheus.Desc
 	cpuUtilDesc       *prometheus.Desc
@@ -16,6 +28,7 @@ type scoreCollector struct {
 	ioUtilDesc        *prometheus.Desc
 	netUtilDesc       *prometheus.Desc
 	userUtilDesc      *prometheus.Desc
+	userSourceDesc    *prometheus.Desc
 }
 
 func NewScoreCollector() *scoreCollector {
@@ -34,7 +47,7 @@ func NewScoreCollector() *scoreCollector {
 		),
 		gpuUtilDesc: prometheus.NewDesc(
 			"syscore_scaled_gpu_util",
-			"Scaled average of GPU util (busy % and VRAM) used in utilization score",
+			"Scaled GPU util (aggregated across cards, see gpu.go) used in utilization score",
 			nil,
 			nil,
 		),
@@ -46,7 +59,7 @@ func NewScoreCollector() *scoreCollector {
 		),
 		ioUtilDesc: prometheus.NewDesc(
 			"syscore_scaled_io_util",
-			"Scaled max IO util (see io.go) used in utilization score",
+			"Scaled max IO util (see io.go and netfs.go) used in utilization score",
 			nil,
 			nil,
 		),
@@ -58,10 +71,16 @@ func NewScoreCollector() *scoreCollector {
 		),
 		userUtilDesc: prometheus.NewDesc(
 			"syscore_user_util",
-			"Ratio of user count to available hardware (1 GPU/user or 16 CPU/user)",
+			"Ratio of user count to available hardware (1 GPU/user or 16 CPU/user), or Slurm allocated fraction",
 			nil,
 			nil,
 		),
+		userSourceDesc: prometheus.NewDesc(
+			"syscore_user_util_source",
+			"Source used for the user component of the score (sessions or slurm)",
+			[]string{"source"},
+			nil,
+		),
 	}
 }
 
@@ -78,12 +97,35 @@ func (sc *scoreCollector) Collect(ch chan<- prometheus.Metric) {
 	memUtil := SharedMemUsed
 	ioUtil := SharedMaxIOTime
 	netUtil := SharedMaxNetSaturation
+	runqueueRatio := SharedRunqueueRatio
+
+	// Parallel filesystems never show up in diskstats
+	if ScoreIOIncludeNetFS {
+		ioUtil = math.Max(ioUtil, SharedMaxNetFSUtil)
+	}
+
+	// Real stall data instead of the heuristics, when configured and the kernel has PSI
+	if SharedPSIAvailable {
+		if ScoreCPUFromPSI {
+			cpuUtil = SharedPSICPU
+		}
+		if ScoreMemFromPSI {
+			memUtil = SharedPSIMemory
+		}
+		if ScoreIOFromPSI {
+			ioUtil = SharedPSIIO
+		}
+	}
 
 	// Calculate user util
-	userUtil := getUserUtilization()
+	userUtil, userSource := getUserComponent()
 
 	// Scale utilization values
-	scaledUtils := utilScaling(gpuUtil, cpuUtil, memUtil, ioUtil, netUtil, hasGPU)
+	scaledUtils := utilScaling(gpuUtil, cpuUtil, memUtil, ioUtil, netUtil, runqueueRatio, hasGPU)
+	// A full scratch or /tmp makes the node unusable, so it reads as busy
+	if SharedFSFull {
+		scaledUtils.f = 1
+	}
 
 	if hasGPU {
 		// Export scaled GPU
@@ -111,9 +153,13 @@ func (sc *scoreCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(
 		sc.userUtilDesc, prometheus.GaugeValue, userUtil,
 	)
+	ch <- prometheus.MustNewConstMetric(
+		sc.userSourceDesc, prometheus.GaugeValue, 1, userSource,
+	)
 
 	// Calcualte weighted utilization score
 	weighted := calcWeightedScore(scaledUtils, userUtil, hasGPU)
+	sharedWeightedScore.Store(&weighted)
 
 	ch <- prometheus.MustNewConstMetric(
 		sc.weightedScoreDesc, prometheus.GaugeValue, weighted,
@@ -121,6 +167,25 @@ func (sc *scoreCollector) Collect(ch chan<- prometheus.Metric) {
 
 }
 
+// getUserComponent picks between session counting and Slurm allocation based on UserUtilPolicy
+func getUserComponent() (float64, string) {
+	switch UserUtilPolicy {
+	case "sessions":
+		return getUserUtilization(), "sessions"
+	case "slurm":
+		gpuNode, _ := utility.GetGPUConfig()
+		return getSlurmData().allocatedFraction(gpuNode), "slurm"
+	default: // "auto"
+		// Session counts mean nothing once jobs own the node
+		data := getSlurmData()
+		if data.jobCount > 0 {
+			gpuNode, _ := utility.GetGPUConfig()
+			return data.allocatedFraction(gpuNode), "slurm"
+		}
+		return getUserUtilization(), "sessions"
+	}
+}
+
 func getUserUtilization() float64 {
 	userCount := SharedUserCount
 
@@ -128,15 +193,15 @@ func getUserUtilization() float64 {
 
 	var capacity int
 	if gpuNode {
-		// GPU Node: 1 user per GPU
-		capacity = gpuCount
+		// GPU Node: 1 user per healthy GPU
+		capacity = gpuCount - SharedDegradedGPUs
 	} else {
-		// CPU Node: 16 cores per user
-		capacity = runtime.NumCPU() / 16
+		// CPU Node: 16 usable cores per user
+		capacity = len(utility.GetCPUCapacity().Usable) / 16
 	}
 
 	// Prevent division by zero
-	if capacity == 0 {
+	if capacity <= 0 {
 		capacity = 1
 	}
 
@@ -151,7 +216,7 @@ func getUserUtilization() float64 {
 }
 
 type scaledUtilizations struct {
-	g, c, m, i, n float64
+	g, c, m, i, n, r, f float64
 }
 
 func calcWeightedScore(scaledUtils scaledUtilizations, usersUtil float64, hasGPU bool) float64 {
@@ -171,12 +236,14 @@ func calcWeightedScore(scaledUtils scaledUtilizations, usersUtil float64, hasGPU
 		(1 - wGPU*scaledUtils.g) *
 		(1 - wIO*scaledUtils.i) *
 		(1 - wNet*scaledUtils.n) *
-		(1 - wUser*usersUtil))
+		(1 - wUser*usersUtil) *
+		(1 - ScoreRunqueueWeight*scaledUtils.r) *
+		(1 - ScoreFSFullWeight*scaledUtils.f))
 
 	return score * 100
 }
 
-func utilScaling(gpuUtil, cpuUtil, memUtil, ioUtil, netUtil float64, hasGPU bool) scaledUtilizations {
+func utilScaling(gpuUtil, cpuUtil, memUtil, ioUtil, netUtil, runqueueRatio float64, hasGPU bool) scaledUtilizations {
 
 	// Nonlinear (higher util penalized more)
 	scaledGPU := 0.0
@@ -187,6 +254,8 @@ func utilScaling(gpuUtil, cpuUtil, memUtil, ioUtil, netUtil float64, hasGPU bool
 	scaledMem := math.Pow(memUtil, 1.5)
 	scaledIO := math.Pow(ioUtil, 1.2)
 	scaledNet := 1 - math.Exp(-2*netUtil) // Exponential saturation for network congestion
+	// Only oversubscription (more runnable tasks than CPUs) counts as saturation
+	scaledRunqueue := 1 - math.Exp(-2*math.Max(0, runqueueRatio-1))
 
 	return scaledUtilizations{
 		g: scaledGPU,
@@ -194,5 +263,6 @@ func utilScaling(gpuUtil, cpuUtil, memUtil, ioUtil, netUtil float64, hasGPU bool
 		m: scaledMem,
 		i: scaledIO,
 		n: scaledNet,
+		r: scaledRunqueue,
 	}
 }
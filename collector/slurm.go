@@ -1,20 +1,92 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type slurmCollector struct {
-	slurmStateDesc    *prometheus.Desc
-	slurmJobCountDesc *prometheus.Desc
-	slurmReservedDesc *prometheus.Desc
+	slurmStateDesc         *prometheus.Desc
+	slurmJobCountDesc      *prometheus.Desc
+	slurmReservedDesc      *prometheus.Desc
+	slurmMemDesc           *prometheus.Desc
+	slurmQueryDurationDesc *prometheus.Desc
+	slurmQueryErrorsDesc   *prometheus.Desc
 }
 
+// Snapshot of everything we know about this node from Slurm
+type slurmNodeData struct {
+	state    string
+	jobCount int
+	reserved int64
+	fetched  time.Time
+
+	// Allocation as reported by scontrol (CPUAlloc/CPUTot and gres/gpu in AllocTRES/CfgTRES)
+	cpuAlloc, cpuTotal    int
+	gpuAlloc, gpuTotal    int
+	memAllocMB, memRealMB int // AllocMem/RealMemory
+
+	// Slurm GPU indices handed to jobs, from GresUsed=gpu:2(IDX:0-1) in the detailed output
+	gpuAllocIdx []int
+	gpuIdxKnown bool
+
+	activeFeatures    []string
+	availableFeatures []string
+	featuresKnown     bool // Feature fields were present in the scontrol output
+	comment           string
+}
+
+// allocatedFraction returns how much of the node is handed out to jobs (0-1)
+func (d slurmNodeData) allocatedFraction(gpuNode bool) float64 {
+	alloc, total := d.cpuAlloc, d.cpuTotal
+	if gpuNode && d.gpuTotal > 0 {
+		alloc, total = d.gpuAlloc, d.gpuTotal
+	}
+	if total <= 0 {
+		return 0
+	}
+	fraction := float64(alloc) / float64(total)
+	if fraction > 1.0 {
+		fraction = 1.0
+	}
+	return fraction
+}
+
+var (
+	// Shared between scrapers so extra Prometheus instances don't multiply Slurm load.
+	// Refreshes run in the background, one at a time, and never under the lock
+	slurmCacheMu     sync.Mutex
+	slurmCache       slurmNodeData
+	slurmRefreshDone chan struct{} // Non-nil while a refresh is running
+	slurmFirstWait   time.Time     // Deadline shared by everyone waiting for the first snapshot
+
+	// Per query bookkeeping, exported by the collector
+	slurmStatsMu       sync.Mutex
+	slurmQueryDuration = make(map[string]float64)
+	slurmQueryErrors   = make(map[string]float64)
+
+	slurmStateRegex     = regexp.MustCompile(`State=([A-Z]+)`)
+	slurmCPUAllocRegex  = regexp.MustCompile(`CPUAlloc=(\d+)`)
+	slurmCPUTotRegex    = regexp.MustCompile(`CPUTot=(\d+)`)
+	slurmAllocTRESRegex = regexp.MustCompile(`AllocTRES=(\S*)`)
+	slurmCfgTRESRegex   = regexp.MustCompile(`CfgTRES=(\S*)`)
+	slurmFeaturesRegex  = regexp.MustCompile(`ActiveFeatures=(\S*)`)
+	slurmAvailRegex     = regexp.MustCompile(`AvailableFeatures=(\S*)`)
+	slurmAllocMemRegex  = regexp.MustCompile(`AllocMem=(\d+)`)
+	slurmRealMemRegex   = regexp.MustCompile(`RealMemory=(\d+)`)
+	slurmGresUsedRegex  = regexp.MustCompile(`GresUsed=(\S*)`)
+	slurmCommentRegex   = regexp.MustCompile(`(?m)^\s*Comment=(.*)$`)
+	slurmGPUIdxRegex    = regexp.MustCompile(`(?:^|,)gpu[^(]*\(IDX:([^)]*)\)`)
+)
+
 func NewSlurmCollector() *slurmCollector {
 	return &slurmCollector{
 		slurmStateDesc: prometheus.NewDesc(
@@ -35,6 +107,24 @@ func NewSlurmCollector() *slurmCollector {
 			nil,
 			nil,
 		),
+		slurmMemDesc: prometheus.NewDesc(
+			"syscore_slurm_mem_bytes",
+			"Memory Slurm has configured (real) and handed out to jobs (allocated)",
+			[]string{"type"},
+			nil,
+		),
+		slurmQueryDurationDesc: prometheus.NewDesc(
+			"syscore_slurm_query_duration_seconds",
+			"Duration of the most recent Slurm query",
+			[]string{"query"},
+			nil,
+		),
+		slurmQueryErrorsDesc: prometheus.NewDesc(
+			"syscore_slurm_query_errors_total",
+			"Number of failed or timed out Slurm queries",
+			[]string{"query"},
+			nil,
+		),
 	}
 }
 
@@ -43,31 +133,128 @@ func (sc *slurmCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (sc *slurmCollector) Collect(ch chan<- prometheus.Metric) {
-	hostname := getShortHostname()
-
-	state := getSlurmNodeState(hostname)
-
-	jobCount := getActiveJobCount(hostname)
-
-	isReserved := getNodeReservationStatus(hostname)
+	data := getSlurmData()
 
 	ch <- prometheus.MustNewConstMetric(
 		sc.slurmStateDesc,
 		prometheus.GaugeValue,
 		1.0,
-		state,
+		data.state,
 	)
 	ch <- prometheus.MustNewConstMetric(
 		sc.slurmJobCountDesc,
 		prometheus.GaugeValue,
-		float64(jobCount),
+		float64(data.jobCount),
 	)
 	ch <- prometheus.MustNewConstMetric(
 		sc.slurmReservedDesc,
 		prometheus.GaugeValue,
-		float64(isReserved),
+		float64(data.reserved),
 	)
+	if data.memRealMB > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			sc.slurmMemDesc,
+			prometheus.GaugeValue,
+			float64(data.memRealMB)*1024*1024,
+			"real",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			sc.slurmMemDesc,
+			prometheus.GaugeValue,
+			float64(data.memAllocMB)*1024*1024,
+			"allocated",
+		)
+	}
+
+	slurmStatsMu.Lock()
+	defer slurmStatsMu.Unlock()
+	for query, duration := range slurmQueryDuration {
+		ch <- prometheus.MustNewConstMetric(
+			sc.slurmQueryDurationDesc,
+			prometheus.GaugeValue,
+			duration,
+			query,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			sc.slurmQueryErrorsDesc,
+			prometheus.CounterValue,
+			slurmQueryErrors[query],
+			query,
+		)
+	}
+}
+
+// getSlurmData returns cached Slurm data and starts a background refresh once SlurmCacheTTL
+// has passed. Stale data is served while the refresh runs, so a slow slurmctld never blocks
+// a scrape. Only callers before the first snapshot wait, together for at most SlurmCommandTimeout
+func getSlurmData() slurmNodeData {
+	slurmCacheMu.Lock()
+	data := slurmCache
+	if !data.fetched.IsZero() && time.Since(data.fetched) < SlurmCacheTTL {
+		slurmCacheMu.Unlock()
+		return data
+	}
+	if slurmRefreshDone == nil {
+		slurmRefreshDone = make(chan struct{})
+		go refreshSlurmData(slurmRefreshDone)
+	}
+	if slurmFirstWait.IsZero() {
+		slurmFirstWait = time.Now().Add(SlurmCommandTimeout)
+	}
+	done := slurmRefreshDone
+	deadline := slurmFirstWait
+	slurmCacheMu.Unlock()
+
+	if !data.fetched.IsZero() {
+		return data
+	}
+
+	// Nothing cached yet
+	select {
+	case <-done:
+		slurmCacheMu.Lock()
+		defer slurmCacheMu.Unlock()
+		return slurmCache
+	case <-time.After(time.Until(deadline)):
+		return slurmNodeData{state: "UNKNOWN"}
+	}
+}
+
+func refreshSlurmData(done chan struct{}) {
+	hostname := getShortHostname()
+	data := getSlurmNodeInfo(hostname)
+	data.jobCount = getActiveJobCount(hostname)
+	data.reserved = getNodeReservationStatus(hostname)
+	data.fetched = time.Now()
+
+	slurmCacheMu.Lock()
+	slurmCache = data
+	slurmRefreshDone = nil
+	slurmCacheMu.Unlock()
+	close(done)
+}
+
+// runSlurmCommand runs a Slurm CLI command bounded by SlurmCommandTimeout
+// so an unreachable slurmctld can't hang the scrape
+func runSlurmCommand(query string, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SlurmCommandTimeout)
+	defer cancel()
+
+	start := time.Now()
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	duration := time.Since(start).Seconds()
 
+	slurmStatsMu.Lock()
+	slurmQueryDuration[query] = duration
+	if _, ok := slurmQueryErrors[query]; !ok {
+		slurmQueryErrors[query] = 0
+	}
+	if err != nil {
+		slurmQueryErrors[query]++
+	}
+	slurmStatsMu.Unlock()
+
+	return output, err
 }
 
 func getShortHostname() string {
@@ -78,26 +265,121 @@ func getShortHostname() string {
 	return strings.Split(hostname, ".")[0]
 }
 
-func getSlurmNodeState(hostname string) string {
-	cmd := exec.Command("scontrol", "show", "node", hostname, "-o")
-	output, err := cmd.Output()
+func getSlurmNodeInfo(hostname string) slurmNodeData {
+	output, err := runSlurmCommand("node", "scontrol", "show", "node", hostname, "-d")
 	if err != nil {
 		// Slurm not available or node not in Slurm config
-		return "UNKNOWN"
+		return slurmNodeData{state: "UNKNOWN"}
 	}
+	return parseSlurmNode(string(output))
+}
+
+func parseSlurmNode(output string) slurmNodeData {
+	data := slurmNodeData{state: "UNKNOWN"}
 
 	// State can have modifiers like "IDLE+DRAIN" want the base state
-	re := regexp.MustCompile(`State=([A-Z]+)`)
-	matches := re.FindSubmatch(output)
-	if len(matches) > 1 {
-		return string(matches[1])
+	if matches := slurmStateRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.state = matches[1]
+	}
+	if matches := slurmCPUAllocRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.cpuAlloc, _ = strconv.Atoi(matches[1])
+	}
+	if matches := slurmCPUTotRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.cpuTotal, _ = strconv.Atoi(matches[1])
+	}
+	if matches := slurmAllocTRESRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.gpuAlloc = tresGPUCount(matches[1])
+	}
+	if matches := slurmCfgTRESRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.gpuTotal = tresGPUCount(matches[1])
+	}
+	if matches := slurmAllocMemRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.memAllocMB, _ = strconv.Atoi(matches[1])
+	}
+	if matches := slurmRealMemRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.memRealMB, _ = strconv.Atoi(matches[1])
+	}
+	if matches := slurmGresUsedRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.gpuAllocIdx, data.gpuIdxKnown = gresGPUIndices(matches[1])
+	}
+	// Free text, only unambiguous in the multi-line output where it sits on its own line
+	if matches := slurmCommentRegex.FindStringSubmatch(output); len(matches) > 1 {
+		data.comment = strings.TrimSpace(matches[1])
+	}
+	activeMatches := slurmFeaturesRegex.FindStringSubmatch(output)
+	availMatches := slurmAvailRegex.FindStringSubmatch(output)
+	data.featuresKnown = len(activeMatches) > 1 && len(availMatches) > 1
+	if data.featuresKnown {
+		data.activeFeatures = splitFeatures(activeMatches[1])
+		data.availableFeatures = splitFeatures(availMatches[1])
+	}
+	return data
+}
+
+func splitFeatures(list string) []string {
+	if list == "" || list == "(null)" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// tresGPUCount pulls the GPU count out of a TRES string like "cpu=8,mem=32G,gres/gpu=2"
+func tresGPUCount(tres string) int {
+	var typed int
+	for _, item := range strings.Split(tres, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		if key == "gres/gpu" {
+			return count
+		}
+		// Typed entries (gres/gpu:mi100=2) only matter if the untyped total is missing
+		if strings.HasPrefix(key, "gres/gpu:") {
+			typed += count
+		}
+	}
+	return typed
+}
+
+// gresGPUIndices pulls the allocated GPU indices out of a GresUsed string like
+// "gpu:mi100:2(IDX:0-1),gpu:a100:1(IDX:3)". An idle node reports "gpu:0(IDX:N/A)"
+func gresGPUIndices(gresUsed string) ([]int, bool) {
+	matches := slurmGPUIdxRegex.FindAllStringSubmatch(gresUsed, -1)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	var indices []int
+	for _, match := range matches {
+		if match[1] == "N/A" {
+			continue
+		}
+		for _, part := range strings.Split(match[1], ",") {
+			first, last, isRange := strings.Cut(part, "-")
+			start, err := strconv.Atoi(first)
+			if err != nil {
+				return nil, false
+			}
+			end := start
+			if isRange {
+				if end, err = strconv.Atoi(last); err != nil {
+					return nil, false
+				}
+			}
+			for i := start; i <= end; i++ {
+				indices = append(indices, i)
+			}
+		}
 	}
-	return "UNKNOWN"
+	return indices, true
 }
 
 func getActiveJobCount(hostname string) int {
-	cmd := exec.Command("squeue", "-w", hostname, "-h", "-o", "%i")
-	output, err := cmd.Output()
+	output, err := runSlurmCommand("jobs", "squeue", "-w", hostname, "-h", "-o", "%i")
 	if err != nil {
 		// squeue failed or no jobs
 		return 0
@@ -114,8 +396,7 @@ func getActiveJobCount(hostname string) int {
 }
 
 func getNodeReservationStatus(hostname string) int64 {
-	cmd := exec.Command("scontrol", "show", "reservation", "-o")
-	output, err := cmd.Output()
+	output, err := runSlurmCommand("reservation", "scontrol", "show", "reservation", "-o")
 	if err != nil {
 		return 0
 	}
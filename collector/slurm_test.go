@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGresGPUIndices(t *testing.T) {
+	tests := []struct {
+		gresUsed string
+		want     []int
+		wantOK   bool
+	}{
+		{"gpu:0(IDX:N/A)", nil, true},
+		{"gpu:2(IDX:0-1)", []int{0, 1}, true},
+		{"gpu:mi100:3(IDX:0,2-3)", []int{0, 2, 3}, true},
+		{"gpu:a100:1(IDX:3),gpu:t4:1(IDX:5)", []int{3, 5}, true},
+		{"shard:0(IDX:N/A),gpu:1(IDX:2)", []int{2}, true},
+		{"gpu:2", nil, false}, // No IDX in non-detailed output
+		{"(null)", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := gresGPUIndices(tt.gresUsed)
+		if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("gresGPUIndices(%q) = %v, %v, want %v, %v", tt.gresUsed, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseSlurmNode(t *testing.T) {
+	// Multi-line scontrol show node -d, the comment is free text on its own line
+	output := `NodeName=g001 Arch=x86_64 CoresPerSocket=32
+   CPUAlloc=16 CPUEfctv=64 CPUTot=64 CPULoad=12.50
+   AvailableFeatures=mi100,ib
+   ActiveFeatures=mi100,ib
+   Gres=gpu:mi100:4
+   GresUsed=gpu:mi100:2(IDX:1,3)
+   RealMemory=512000 AllocMem=128000 FreeMem=300000 Sockets=2 Boards=1
+   State=MIXED ThreadsPerCore=1 TmpDisk=0 Weight=1 Owner=N/A MCS_label=N/A
+   CfgTRES=cpu=64,mem=500G,billing=64,gres/gpu=4
+   AllocTRES=cpu=16,mem=125G,gres/gpu=2
+   Comment=PSU swapped, watch temps util_mid
+`
+	got := parseSlurmNode(output)
+	want := slurmNodeData{
+		state:             "MIXED",
+		cpuAlloc:          16,
+		cpuTotal:          64,
+		gpuAlloc:          2,
+		gpuTotal:          4,
+		memAllocMB:        128000,
+		memRealMB:         512000,
+		gpuAllocIdx:       []int{1, 3},
+		gpuIdxKnown:       true,
+		activeFeatures:    []string{"mi100", "ib"},
+		availableFeatures: []string{"mi100", "ib"},
+		featuresKnown:     true,
+		comment:           "PSU swapped, watch temps util_mid",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSlurmNode =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Writes the smoothed utilization score back into Slurm so it shows up in
+// sinfo/scontrol. Uses whichever scontrol is first on PATH.
+
+const (
+	scoreSmoothingAlpha = 0.3 // EWMA weight of the newest score
+	scoreFeaturePrefix  = "util_"
+)
+
+// Bucket upper bounds (score 0-100)
+var scoreBuckets = []struct {
+	limit float64
+	name  string
+}{
+	{33, "util_low"},
+	{66, "util_mid"},
+	{100, "util_high"},
+}
+
+type slurmScoreWriter struct {
+	target     string // "comment" or "feature"
+	dryRun     bool
+	smoothed   float64
+	seeded     bool
+	lastBucket string
+}
+
+// StartSlurmScoreWriter periodically pushes the bucketed score into the node's
+// Comment or ActiveFeatures. Runs until the process exits.
+func StartSlurmScoreWriter(interval time.Duration, target string, dryRun bool) {
+	w := &slurmScoreWriter{target: target, dryRun: dryRun}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			score, ok := latestWeightedScore()
+			if !ok {
+				continue // No scrape yet, a 0 would push util_low and drag the average down
+			}
+			if err := w.update(score); err != nil {
+				log.Printf("WARNING: Failed to write score to Slurm: %v", err)
+			}
+		}
+	}()
+}
+
+func (w *slurmScoreWriter) update(score float64) error {
+	if !w.seeded {
+		w.smoothed = score
+		w.seeded = true
+	} else {
+		w.smoothed = scoreSmoothingAlpha*score + (1-scoreSmoothingAlpha)*w.smoothed
+	}
+
+	bucket := scoreBucket(w.smoothed)
+	// Only touch slurmctld when the bucket actually changes
+	if bucket == w.lastBucket {
+		return nil
+	}
+
+	// The node's current comment/features are kept, only our bucket is swapped
+	args, err := w.updateArgs(getShortHostname(), bucket, getSlurmData())
+	if err != nil {
+		return err
+	}
+
+	if w.dryRun {
+		log.Printf("INFO: [dry-run] scontrol %s", strings.Join(args, " "))
+		w.lastBucket = bucket
+		return nil
+	}
+
+	if output, err := runSlurmCommand("update", "scontrol", args...); err != nil {
+		return fmt.Errorf("scontrol %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	w.lastBucket = bucket
+	return nil
+}
+
+// updateArgs builds the scontrol arguments for writing bucket into the node
+func (w *slurmScoreWriter) updateArgs(hostname, bucket string, data slurmNodeData) ([]string, error) {
+	switch w.target {
+	case "comment":
+		// Admins leave maintenance notes here, which an unread comment would wipe
+		if data.state == "UNKNOWN" {
+			return nil, fmt.Errorf("node comment unavailable, skipping update")
+		}
+		return []string{"update", "NodeName=" + hostname, "Comment=" + replaceScoreComment(data.comment, bucket)}, nil
+	case "feature":
+		// Without the current features we would overwrite the admin's with just the bucket
+		if data.state == "UNKNOWN" || !data.featuresKnown {
+			return nil, fmt.Errorf("node features unavailable, skipping update")
+		}
+		// ActiveFeatures must be a subset of AvailableFeatures, so every bucket is made available
+		available := replaceScoreFeature(data.availableFeatures, "")
+		for _, b := range scoreBuckets {
+			available = append(available, b.name)
+		}
+		active := replaceScoreFeature(data.activeFeatures, bucket)
+		return []string{
+			"update", "NodeName=" + hostname,
+			"AvailableFeatures=" + strings.Join(available, ","),
+			"ActiveFeatures=" + strings.Join(active, ","),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown Slurm score target %q", w.target)
+	}
+}
+
+// replaceScoreComment swaps the util_* word in comment for bucket, or appends it,
+// keeping the rest of the comment
+func replaceScoreComment(comment, bucket string) string {
+	var words []string
+	if comment != "(null)" {
+		words = strings.Fields(comment)
+	}
+	return strings.Join(replaceScoreFeature(words, bucket), " ")
+}
+
+func scoreBucket(score float64) string {
+	for _, b := range scoreBuckets {
+		if score < b.limit {
+			return b.name
+		}
+	}
+	return scoreBuckets[len(scoreBuckets)-1].name
+}
+
+// replaceScoreFeature swaps any existing util_* feature for the new bucket,
+// leaving the admin's own features alone. An empty bucket only strips them
+func replaceScoreFeature(features []string, bucket string) []string {
+	var updated []string
+	for _, f := range features {
+		if strings.HasPrefix(f, scoreFeaturePrefix) {
+			continue
+		}
+		updated = append(updated, f)
+	}
+	if bucket == "" {
+		return updated
+	}
+	return append(updated, bucket)
+}
@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeScontrol puts a scontrol on PATH that appends its arguments to a log file
+func fakeScontrol(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "scontrol"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+func readCalls(t *testing.T, logPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func setSlurmCache(t *testing.T, data slurmNodeData) {
+	t.Helper()
+	data.fetched = time.Now()
+	slurmCacheMu.Lock()
+	prev := slurmCache
+	slurmCache = data
+	slurmCacheMu.Unlock()
+	t.Cleanup(func() {
+		slurmCacheMu.Lock()
+		slurmCache = prev
+		slurmCacheMu.Unlock()
+	})
+}
+
+func TestUpdateArgs(t *testing.T) {
+	known := slurmNodeData{
+		state:             "MIXED",
+		featuresKnown:     true,
+		activeFeatures:    []string{"ib", "util_high"},
+		availableFeatures: []string{"ib", "mi100", "util_low", "util_mid", "util_high"},
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		data    slurmNodeData
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "comment",
+			target: "comment",
+			data:   slurmNodeData{state: "IDLE"},
+			want:   []string{"update", "NodeName=n1", "Comment=util_low"},
+		},
+		{
+			name:   "comment keeps admin note",
+			target: "comment",
+			data:   slurmNodeData{state: "MIXED", comment: "fan replaced 2026-10-01"},
+			want:   []string{"update", "NodeName=n1", "Comment=fan replaced 2026-10-01 util_low"},
+		},
+		{
+			name:   "comment replaces previous bucket",
+			target: "comment",
+			data:   slurmNodeData{state: "MIXED", comment: "check ib util_high"},
+			want:   []string{"update", "NodeName=n1", "Comment=check ib util_low"},
+		},
+		{
+			name:    "comment skipped when scontrol failed",
+			target:  "comment",
+			data:    slurmNodeData{state: "UNKNOWN"},
+			wantErr: true,
+		},
+		{
+			name:   "feature keeps admin features",
+			target: "feature",
+			data:   known,
+			want: []string{
+				"update", "NodeName=n1",
+				"AvailableFeatures=ib,mi100,util_low,util_mid,util_high",
+				"ActiveFeatures=ib,util_low",
+			},
+		},
+		{
+			name:   "feature on node without features",
+			target: "feature",
+			data:   slurmNodeData{state: "IDLE", featuresKnown: true},
+			want: []string{
+				"update", "NodeName=n1",
+				"AvailableFeatures=util_low,util_mid,util_high",
+				"ActiveFeatures=util_low",
+			},
+		},
+		{
+			name:    "feature skipped when scontrol failed",
+			target:  "feature",
+			data:    slurmNodeData{state: "UNKNOWN"},
+			wantErr: true,
+		},
+		{
+			name:    "feature skipped when features missing",
+			target:  "feature",
+			data:    slurmNodeData{state: "IDLE"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown target",
+			target:  "bogus",
+			data:    known,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &slurmScoreWriter{target: tt.target}
+			got, err := w.updateArgs("n1", "util_low", tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterOnlyCallsOnBucketChange(t *testing.T) {
+	logPath := fakeScontrol(t)
+	setSlurmCache(t, slurmNodeData{state: "IDLE"})
+	w := &slurmScoreWriter{target: "comment"}
+	hostname := getShortHostname()
+
+	for _, score := range []float64{10, 12, 11} {
+		if err := w.update(score); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := readCalls(t, logPath)
+	if want := []string{"update NodeName=" + hostname + " Comment=util_low"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+
+	// A jump to 100 is smoothed, it takes a few ticks to leave util_low
+	for i := 0; i < 10; i++ {
+		if err := w.update(100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls = readCalls(t, logPath)
+	want := []string{
+		"update NodeName=" + hostname + " Comment=util_low",
+		"update NodeName=" + hostname + " Comment=util_mid",
+		"update NodeName=" + hostname + " Comment=util_high",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestWriterFeatureMode(t *testing.T) {
+	logPath := fakeScontrol(t)
+	setSlurmCache(t, slurmNodeData{
+		state:             "IDLE",
+		featuresKnown:     true,
+		activeFeatures:    []string{"ib"},
+		availableFeatures: []string{"ib"},
+	})
+	w := &slurmScoreWriter{target: "feature"}
+	if err := w.update(80); err != nil {
+		t.Fatal(err)
+	}
+	calls := readCalls(t, logPath)
+	want := []string{"update NodeName=" + getShortHostname() +
+		" AvailableFeatures=ib,util_low,util_mid,util_high ActiveFeatures=ib,util_high"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestWriterFeatureModeSkipsUnknownNode(t *testing.T) {
+	logPath := fakeScontrol(t)
+	setSlurmCache(t, slurmNodeData{state: "UNKNOWN"})
+	w := &slurmScoreWriter{target: "feature"}
+	if err := w.update(80); err == nil {
+		t.Fatal("expected an error for a node with unreadable features")
+	}
+	if calls := readCalls(t, logPath); len(calls) != 0 {
+		t.Fatalf("scontrol called on unknown node: %q", calls)
+	}
+	if w.lastBucket != "" {
+		t.Errorf("lastBucket = %q, a skipped update must be retried", w.lastBucket)
+	}
+}
+
+func TestWriterDryRun(t *testing.T) {
+	logPath := fakeScontrol(t)
+	setSlurmCache(t, slurmNodeData{state: "IDLE"})
+	w := &slurmScoreWriter{target: "comment", dryRun: true}
+	if err := w.update(50); err != nil {
+		t.Fatal(err)
+	}
+	if calls := readCalls(t, logPath); len(calls) != 0 {
+		t.Fatalf("dry-run called scontrol: %q", calls)
+	}
+	if w.lastBucket != "util_mid" {
+		t.Errorf("lastBucket = %q, want util_mid", w.lastBucket)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/amitch747/system-scorer/utility"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -19,10 +21,20 @@ import (
 type userCollector struct {
 	userSessionsDesc *prometheus.Desc
 	eachSessionDesc  *prometheus.Desc
+	gpuUsersDesc     *prometheus.Desc
 }
 
 var SharedUserCount float64
 
+// Accounts outside UID_MIN-UID_MAX are root, display managers and daemons rather than people
+var (
+	uidRangeOnce   sync.Once
+	uidMin, uidMax uint64
+)
+
+// nobody, which daemons drop privileges to. Inside UID_MAX on some distributions
+const nobodyUID = 65534
+
 func NewUserCollector() *userCollector {
 	return &userCollector{
 		userSessionsDesc: prometheus.NewDesc(
@@ -37,6 +49,12 @@ func NewUserCollector() *userCollector {
 			[]string{"user", "ip", "tty"},
 			nil,
 		),
+		gpuUsersDesc: prometheus.NewDesc(
+			"syscore_gpu_users",
+			"Number of non-system users with processes holding GPU memory or engine time",
+			nil,
+			nil,
+		),
 	}
 }
 
@@ -92,13 +110,7 @@ func (uc *userCollector) Collect(ch chan<- prometheus.Metric) {
 		// Find username
 		username, ok := usernameUID[uid]
 		if !ok {
-			// Try built-in lookup first (works for local users)
-			if userObj, err := user.LookupId(uid); err == nil {
-				username = userObj.Username
-			} else {
-				// Fall back to getent for SSSD/LDAP users
-				username = lookupUsernameViaGetent(uid)
-			}
+			username = lookupUsername(uid)
 			usernameUID[uid] = username
 		}
 
@@ -146,7 +158,24 @@ func (uc *userCollector) Collect(ch chan<- prometheus.Metric) {
 			processedPIDs, len(userSessionCount), len(sessionSet))
 	}
 
-	SharedUserCount = float64(len(userSessionCount))
+	// Batch jobs holding a GPU count as users even without a login session
+	gpuUsers := getSharedGPUUsers()
+	activeUsers := make(map[string]struct{}, len(userSessionCount)+len(gpuUsers))
+	for user := range userSessionCount {
+		activeUsers[user] = struct{}{}
+	}
+	for user := range gpuUsers {
+		activeUsers[user] = struct{}{}
+	}
+	SharedUserCount = float64(len(activeUsers))
+
+	if gpuNode, _ := utility.GetGPUConfig(); gpuNode {
+		ch <- prometheus.MustNewConstMetric(
+			uc.gpuUsersDesc,
+			prometheus.GaugeValue,
+			float64(len(gpuUsers)),
+		)
+	}
 
 	for user, count := range userSessionCount {
 		ch <- prometheus.MustNewConstMetric(
@@ -226,6 +255,51 @@ func readSSHClient(pid string) (string, error) {
 	return "unknown", nil
 }
 
+// isSystemUID reports whether uid belongs to a system account: outside UID_MIN-UID_MAX
+// in /etc/login.defs, or nobody
+func isSystemUID(uid string) bool {
+	uidRangeOnce.Do(func() { uidMin, uidMax = readUIDRange("/etc/login.defs") })
+	n, err := strconv.ParseUint(uid, 10, 32)
+	return err != nil || n < uidMin || n > uidMax || n == nobodyUID
+}
+
+// readUIDRange reads UID_MIN and UID_MAX from login.defs, falling back to the
+// common defaults of 1000 and 60000
+func readUIDRange(path string) (uint64, uint64) {
+	minUID, maxUID := uint64(1000), uint64(60000)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return minUID, maxUID
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "UID_MIN":
+			minUID = n
+		case "UID_MAX":
+			maxUID = n
+		}
+	}
+	return minUID, maxUID
+}
+
+// lookupUsername resolves a uid, falling back to the uid itself
+func lookupUsername(uid string) string {
+	// Try built-in lookup first (works for local users)
+	if userObj, err := user.LookupId(uid); err == nil {
+		return userObj.Username
+	}
+	// Fall back to getent for SSSD/LDAP users
+	return lookupUsernameViaGetent(uid)
+}
+
 // lookupUsernameViaGetent uses getent to lookup username via NSS (SSSD/LDAP/NIS)
 // This works even in statically compiled binaries where user.LookupId() fails
 func lookupUsernameViaGetent(uid string) string {
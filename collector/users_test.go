@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadUIDRange(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content  string
+		min, max uint64
+	}{
+		{"# UID_MIN 2000\nUID_MIN\t\t\t 5000\nUID_MAX 90000\n", 5000, 90000},
+		{"UID_MAX 70000\n", 1000, 70000},         // UID_MIN not set
+		{"UID_MIN lots\nUID_MAX\n", 1000, 60000}, // Malformed
+		{"SYS_UID_MIN 201\nSYS_UID_MAX 999\n", 1000, 60000},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "login.defs")
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if min, max := readUIDRange(path); min != tt.min || max != tt.max {
+			t.Errorf("readUIDRange(%q) = %d, %d, want %d, %d", tt.content, min, max, tt.min, tt.max)
+		}
+	}
+	if min, max := readUIDRange(filepath.Join(dir, "missing")); min != 1000 || max != 60000 {
+		t.Errorf("missing login.defs = %d, %d, want 1000, 60000", min, max)
+	}
+}
+
+func TestIsSystemUID(t *testing.T) {
+	// Pin the range instead of depending on the host's login.defs
+	uidRangeOnce.Do(func() {})
+	prevMin, prevMax := uidMin, uidMax
+	uidMin, uidMax = 1000, 60000
+	t.Cleanup(func() { uidMin, uidMax = prevMin, prevMax })
+
+	// nobody and the overflow/nfsnobody uids are daemons, not users
+	for _, uid := range []string{"0", "1", "999", "65534", "4294967294", "", "nobody"} {
+		if !isSystemUID(uid) {
+			t.Errorf("isSystemUID(%q) = false, want true", uid)
+		}
+	}
+	if isSystemUID("1000") {
+		t.Error("isSystemUID(1000) = true, want false")
+	}
+}
@@ -2,9 +2,101 @@ package collector
 
 import (
 	"regexp"
+	"time"
 )
 
 // '^(veth|cni|flannel|docker|br-).*'
 var NetDeviceFilter = regexp.MustCompile("^(lo|veth|docker|br-|tun).*")
 
+// Block devices left out of IO metrics. Include is optional (nil keeps everything not excluded)
+var (
+	DiskDeviceExclude = regexp.MustCompile("^(ram|loop|zram|fd|sr)[0-9]")
+	DiskDeviceInclude *regexp.Regexp
+)
+
+// Which block devices feed the score's IO term: "all", "physical" (disks without slaves)
+// or "logical" (top of the dm/md stack, i.e. the volumes users see)
+var IOScoreLayer = "all"
+
+// Include network filesystem (NFS/Lustre) throughput in the score's IO term.
+// Bandwidth is the B/s counted as saturated, 0 uses the fastest network link
+var (
+	ScoreIOIncludeNetFS bool
+	NetFSBandwidth      float64
+)
+
+// Filesystems watched for capacity and inodes. Full means space or inode usage at or above the threshold (0-1)
+var (
+	FSMountpoints   = regexp.MustCompile("^(/|/tmp|/var/tmp|/home|/scratch|/local|/lscratch)$")
+	FSFullThreshold = 0.95
+	FSStatTimeout   = 5 * time.Second // statfs deadline, slower mounts are reported stale
+)
+
+// Weight of the disk full term in the score. 0 leaves it out
+var ScoreFSFullWeight = 0.0
+
 var ScrapeInterval float64 = 15
+
+var (
+	SlurmCacheTTL       = 30 * time.Second // How long Slurm query results are reused across scrapes
+	SlurmCommandTimeout = 5 * time.Second  // Deadline for each scontrol/squeue call
+)
+
+// How the user component of the score is computed:
+// "sessions" counts login sessions, "slurm" uses the allocated fraction of the node,
+// "auto" uses the allocated fraction only while Slurm jobs are running here
+var UserUtilPolicy = "auto"
+
+var (
+	SlurmWriteInterval time.Duration // 0 disables writing the score back into Slurm
+	SlurmWriteTarget   = "comment"   // "comment" or "feature"
+	SlurmWriteDryRun   bool          // Log scontrol updates instead of running them
+)
+
+// Per-card GPU utilization blend. Weights are normalized by their sum
+var (
+	GPUUtilBusyWeight   = 0.7
+	GPUUtilMemoryWeight = 0.3
+	GPUUtilGTTWeight    = 0.0
+	GPUMemoryUtilSource = "vram" // Memory term: "vram" (occupancy) or "bandwidth" (mem busy %)
+)
+
+// How per-card GPU utilization becomes the score's GPU term:
+// "mean", "max", "busy_fraction" (share of cards at or above GPUBusyThreshold)
+// or "allocated" (mean over the cards in Slurm's GresUsed IDX list, falls back to mean without Slurm)
+var (
+	GPUUtilAggregation = "mean"
+	GPUBusyThreshold   = 50.0 // Per-card util (0-100)
+)
+
+// Remove time from the score's CPU term. Useful on VMs where steal is high
+var (
+	CPUExcludeSteal  bool // Steal leaves both busy and total time
+	CPUExcludeSystem bool // system, irq and softirq no longer count as busy
+)
+
+// Use PSI "some" avg10 as the score input instead of exec ratio, memory usage or IO time
+var (
+	ScoreCPUFromPSI bool
+	ScoreMemFromPSI bool
+	ScoreIOFromPSI  bool
+)
+
+// Weight of the run queue saturation term in the score. 0 leaves it out
+var ScoreRunqueueWeight = 0.0
+
+// What counts as used memory in the score: "available" (MemTotal - MemAvailable),
+// "anon" (AnonPages + Shmem + used hugepages), "hugepages" ("available" minus free hugepages)
+// or "slurm" (AllocMem/RealMemory, falls back to "available" without Slurm)
+var MemUsedDefinition = "available"
+
+// Memory pressure index: 1 - exp(-steepness * weighted sum of scaled usage, commit, swap and reclaim).
+// Usage, commit and swap keep their original 0.7/0.2/0.1 split, reclaim is added on top so the
+// index is unchanged on a node that isn't reclaiming
+var (
+	MemPressureSteepness     = 3.0
+	MemPressureUsageWeight   = 0.7
+	MemPressureCommitWeight  = 0.2
+	MemPressureSwapWeight    = 0.1
+	MemPressureReclaimWeight = 0.3
+)
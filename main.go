@@ -4,36 +4,150 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/amitch747/system-scorer/aggregator"
 	"github.com/amitch747/system-scorer/collector"
+	"github.com/amitch747/system-scorer/utility"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	// Subcommand: cluster-wide aggregator
+	if len(os.Args) > 1 && os.Args[1] == "aggregate" {
+		runAggregate(os.Args[2:])
+		return
+	}
+
 	// CL flag
 	listenAddr := flag.String("web.listen-address", ":9110", "Metrics port")
+	flag.DurationVar(&collector.SlurmCacheTTL, "slurm.cache-ttl", collector.SlurmCacheTTL, "How long Slurm query results are cached")
+	flag.DurationVar(&collector.SlurmCommandTimeout, "slurm.timeout", collector.SlurmCommandTimeout, "Timeout for each Slurm command")
+	flag.StringVar(&collector.UserUtilPolicy, "score.user-policy", collector.UserUtilPolicy, "User score component source: sessions, slurm or auto")
+	flag.DurationVar(&collector.SlurmWriteInterval, "slurm.write-interval", 0, "Interval for writing the score bucket into Slurm (0 disables)")
+	flag.StringVar(&collector.SlurmWriteTarget, "slurm.write-target", collector.SlurmWriteTarget, "Node field to write the score bucket into: comment or feature")
+	flag.BoolVar(&collector.SlurmWriteDryRun, "slurm.write-dry-run", false, "Log scontrol updates instead of running them")
+	flag.StringVar(&collector.GPUMemoryUtilSource, "score.gpu-memory-source", collector.GPUMemoryUtilSource, "Memory term of GPU utilization: vram or bandwidth")
+	flag.Float64Var(&collector.GPUUtilBusyWeight, "score.gpu-busy-weight", collector.GPUUtilBusyWeight, "Weight of GPU busy % in per-card GPU utilization")
+	flag.Float64Var(&collector.GPUUtilMemoryWeight, "score.gpu-memory-weight", collector.GPUUtilMemoryWeight, "Weight of GPU memory in per-card GPU utilization")
+	flag.Float64Var(&collector.GPUUtilGTTWeight, "score.gpu-gtt-weight", collector.GPUUtilGTTWeight, "Weight of GTT usage in per-card GPU utilization")
+	flag.StringVar(&collector.GPUUtilAggregation, "score.gpu-aggregation", collector.GPUUtilAggregation, "GPU aggregation across cards: mean, max, busy_fraction or allocated")
+	flag.Float64Var(&collector.GPUBusyThreshold, "score.gpu-busy-threshold", collector.GPUBusyThreshold, "Per-card util (0-100) counted as busy for busy_fraction")
+	flag.DurationVar(&utility.GPURedetectInterval, "gpu.redetect-interval", utility.GPURedetectInterval, "How often GPUs are re-detected")
+	flag.StringVar(&utility.SlurmCpusetPath, "cpu.slurm-cpuset", "", "cpuset file limiting the CPUs counted as capacity (e.g. Slurm's cpuset.cpus)")
+	flag.BoolVar(&collector.CPUExcludeSteal, "score.cpu-exclude-steal", false, "Exclude steal time from the score's CPU utilization")
+	flag.BoolVar(&collector.CPUExcludeSystem, "score.cpu-exclude-system", false, "Don't count system/irq/softirq time as useful CPU utilization")
+	flag.BoolVar(&collector.ScoreCPUFromPSI, "score.cpu-psi", false, "Use CPU pressure (PSI) as the score's CPU input")
+	flag.BoolVar(&collector.ScoreMemFromPSI, "score.mem-psi", false, "Use memory pressure (PSI) as the score's memory input")
+	flag.BoolVar(&collector.ScoreIOFromPSI, "score.io-psi", false, "Use IO pressure (PSI) as the score's IO input")
+	flag.Float64Var(&collector.ScoreRunqueueWeight, "score.runqueue-weight", 0, "Weight of the CPU run queue saturation term in the score (0 disables)")
+	flag.StringVar(&collector.MemUsedDefinition, "score.mem-used", collector.MemUsedDefinition, "Used memory definition: available, anon, hugepages or slurm")
+	flag.Float64Var(&collector.MemPressureSteepness, "mem.pressure-steepness", collector.MemPressureSteepness, "Steepness of the memory pressure saturating exponential")
+	flag.Float64Var(&collector.MemPressureUsageWeight, "mem.pressure-usage-weight", collector.MemPressureUsageWeight, "Weight of memory usage in the memory pressure index")
+	flag.Float64Var(&collector.MemPressureCommitWeight, "mem.pressure-commit-weight", collector.MemPressureCommitWeight, "Weight of commit ratio in the memory pressure index")
+	flag.Float64Var(&collector.MemPressureSwapWeight, "mem.pressure-swap-weight", collector.MemPressureSwapWeight, "Weight of swap usage in the memory pressure index")
+	flag.Float64Var(&collector.MemPressureReclaimWeight, "mem.pressure-reclaim-weight", collector.MemPressureReclaimWeight, "Weight of reclaim signals (major faults, direct scans, OOM kills) in the memory pressure index")
+	diskExclude := flag.String("io.device-exclude", collector.DiskDeviceExclude.String(), "Regex of block devices to leave out of IO metrics")
+	flag.StringVar(&collector.IOScoreLayer, "score.io-layer", collector.IOScoreLayer, "Block device layer feeding the score's IO term: all, physical or logical")
+	flag.BoolVar(&collector.ScoreIOIncludeNetFS, "score.io-netfs", false, "Include network filesystem (NFS/Lustre) throughput in the score's IO input")
+	flag.Float64Var(&collector.NetFSBandwidth, "netfs.bandwidth", 0, "Network filesystem throughput (B/s) counted as saturated (0 uses the fastest network link)")
+	flag.Float64Var(&collector.FSFullThreshold, "fs.full-threshold", collector.FSFullThreshold, "Space or inode usage ratio (0-1) at which a filesystem counts as full")
+	flag.Float64Var(&collector.ScoreFSFullWeight, "score.fs-full-weight", 0, "Weight of the disk full term in the score (0 disables)")
+	flag.DurationVar(&collector.FSStatTimeout, "fs.stat-timeout", collector.FSStatTimeout, "Deadline for statfs on each watched mountpoint before it is reported stale")
+	fsMountpoints := flag.String("fs.mountpoints", collector.FSMountpoints.String(), "Regex of mountpoints watched for capacity and inodes")
+	diskInclude := flag.String("io.device-include", "", "Regex of block devices to keep in IO metrics (empty keeps all)")
 	flag.Parse()
 
+	collector.DiskDeviceExclude = compileFlagRegex("io.device-exclude", *diskExclude)
+	collector.DiskDeviceInclude = compileFlagRegex("io.device-include", *diskInclude)
+	collector.FSMountpoints = compileFlagRegex("fs.mountpoints", *fsMountpoints)
+	checkFlagChoice("score.user-policy", collector.UserUtilPolicy, "sessions", "slurm", "auto")
+	checkFlagChoice("slurm.write-target", collector.SlurmWriteTarget, "comment", "feature")
+	checkFlagChoice("score.gpu-memory-source", collector.GPUMemoryUtilSource, "vram", "bandwidth")
+	checkFlagChoice("score.gpu-aggregation", collector.GPUUtilAggregation, "mean", "max", "busy_fraction", "allocated")
+	checkFlagChoice("score.mem-used", collector.MemUsedDefinition, "available", "anon", "hugepages", "slurm")
+	checkFlagChoice("score.io-layer", collector.IOScoreLayer, "all", "physical", "logical")
+
 	// Create registry
 	reg := prometheus.NewRegistry()
 
 	// Register metrics collectors
-	if amdGPUCollector, err := collector.NewAMDGPUCollector(); err == nil {
-		reg.MustRegister(amdGPUCollector)
-	} else {
-		log.Printf("Warning: GPU collector not available: %v", err)
-	}
+	reg.MustRegister(collector.NewGPUCollector())
 	reg.MustRegister(collector.NewUserCollector())
 	reg.MustRegister(collector.NewCPUCollector())
 	reg.MustRegister(collector.NewMemCollector())
 	reg.MustRegister(collector.NewIoCollector())
+	reg.MustRegister(collector.NewNetFSCollector())
+	reg.MustRegister(collector.NewFilesystemCollector())
 	reg.MustRegister(collector.NewNetworkCollector())
+	reg.MustRegister(collector.NewPSICollector())
 	reg.MustRegister(collector.NewSlurmCollector())
 	reg.MustRegister(collector.NewScoreCollector())
 
+	// Optionally push the score into Slurm
+	if collector.SlurmWriteInterval > 0 {
+		collector.StartSlurmScoreWriter(collector.SlurmWriteInterval, collector.SlurmWriteTarget, collector.SlurmWriteDryRun)
+	}
+
 	// Expose metrics
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 	log.Fatal(http.ListenAndServe(*listenAddr, mux))
 }
+
+// compileFlagRegex returns nil for an empty pattern
+func compileFlagRegex(name, pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Fatalf("Invalid --%s: %v", name, err)
+	}
+	return re
+}
+
+// checkFlagChoice exits on a value the collectors would otherwise silently replace with a default
+func checkFlagChoice(name, value string, choices ...string) {
+	if !slices.Contains(choices, value) {
+		log.Fatalf("Invalid --%s %q: must be one of %s", name, value, strings.Join(choices, ", "))
+	}
+}
+
+func runAggregate(args []string) {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	listenAddr := fs.String("web.listen-address", ":9111", "Metrics port")
+	targetsFile := fs.String("targets.file", "", "Static list of exporters (host:port [partition=a,b] [group=g] per line)")
+	slurmPort := fs.Int("targets.slurm-port", 9110, "Exporter port used when building targets from sinfo")
+	interval := fs.Duration("scrape.interval", 30*time.Second, "How often to scrape node exporters")
+	timeout := fs.Duration("scrape.timeout", 10*time.Second, "Timeout for each node scrape")
+	idleThreshold := fs.Float64("idle-threshold", 5, "Score below which a node counts as idle")
+	fs.Parse(args)
+
+	var targets []aggregator.Target
+	var err error
+	if *targetsFile != "" {
+		targets, err = aggregator.LoadTargetsFile(*targetsFile)
+	} else {
+		targets, err = aggregator.SlurmTargets(*slurmPort, *timeout)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load aggregation targets: %v", err)
+	}
+	log.Printf("Aggregating %d exporters", len(targets))
+
+	aggCollector := aggregator.NewAggregateCollector(targets, &http.Client{Timeout: *timeout}, *idleThreshold)
+	go aggCollector.Run(*interval)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(aggCollector)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	log.Fatal(http.ListenAndServe(*listenAddr, mux))
+}
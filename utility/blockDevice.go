@@ -17,10 +17,10 @@ var (
 	deviceInfoMap  map[string]BlockDeviceInfo
 )
 
-func DetectBlockDevices() map[string]BlockDeviceInfo {
+func DetectBlockDevices(sysPath string) map[string]BlockDeviceInfo {
 	devices := make(map[string]BlockDeviceInfo)
 
-	entries, err := os.ReadDir("/sys/block")
+	entries, err := os.ReadDir(filepath.Join(sysPath, "block"))
 	if err != nil {
 		return devices
 	}
@@ -30,13 +30,16 @@ func DetectBlockDevices() map[string]BlockDeviceInfo {
 
 		if strings.HasPrefix(deviceName, "loop") ||
 			strings.HasPrefix(deviceName, "ram") ||
-			strings.HasPrefix(deviceName, "zram") ||
-			strings.HasPrefix(deviceName, "dm-") {
+			strings.HasPrefix(deviceName, "zram") {
+			continue
+		}
+		// Stacked devices take their type from their members below
+		if len(readSlaves(sysPath, deviceName)) > 0 {
 			continue
 		}
 
-		rotationPath := filepath.Join("/sys/block", deviceName, "queue", "rotational")
-		subsysPath := filepath.Join("/sys/block", deviceName, "device", "subsystem")
+		rotationPath := filepath.Join(sysPath, "block", deviceName, "queue", "rotational")
+		subsysPath := filepath.Join(sysPath, "block", deviceName, "device", "subsystem")
 
 		data, err := os.ReadFile(rotationPath)
 		if err != nil {
@@ -59,24 +62,130 @@ func DetectBlockDevices() map[string]BlockDeviceInfo {
 			Rotational: isRotation,
 		}
 	}
+
+	for _, entry := range entries {
+		if info, ok := stackedDeviceInfo(sysPath, entry.Name(), devices, 0); ok {
+			devices[entry.Name()] = info
+		}
+	}
 	return devices
 }
 
+// stackedDeviceInfo resolves dm/md devices through their slaves. The slowest
+// member sets the type since it bounds the array
+func stackedDeviceInfo(sysPath, name string, devices map[string]BlockDeviceInfo, depth int) (BlockDeviceInfo, bool) {
+	slaves := readSlaves(sysPath, name)
+	if len(slaves) == 0 || depth > 8 {
+		return BlockDeviceInfo{}, false
+	}
+
+	rank := map[string]int{"HDD": 3, "SSD": 2, "NVMe": 1}
+	var result BlockDeviceInfo
+	found := false
+	for _, slave := range slaves {
+		info, ok := devices[slave]
+		if !ok {
+			// dm on md (or dm on dm), resolve another level
+			if info, ok = stackedDeviceInfo(sysPath, slave, devices, depth+1); !ok {
+				continue
+			}
+		}
+		if !found || rank[info.Type] > rank[result.Type] {
+			result = info
+			found = true
+		}
+	}
+	return result, found
+}
+
+// readSlaves lists the whole disks under a stacked device, mapping partitions to their disk
+func readSlaves(sysPath, name string) []string {
+	entries, err := os.ReadDir(filepath.Join(sysPath, "block", name, "slaves"))
+	if err != nil {
+		return nil
+	}
+	var slaves []string
+	for _, entry := range entries {
+		slave := entry.Name()
+		if parent, ok := ParentDevice(sysPath, slave); ok {
+			slave = parent
+		}
+		slaves = append(slaves, slave)
+	}
+	return slaves
+}
+
+// BlockLayer describes where a whole disk sits in the device stack
+type BlockLayer struct {
+	Name   string   // Friendly name: dm/name for device-mapper (LVM volumes), otherwise the kernel name
+	Layer  string   // "physical" (no slaves) or "logical" (dm/md built on other devices)
+	Slaves []string // Whole disks underneath
+	Held   bool     // Used by a dm/md device (directly or through a partition)
+}
+
+func ReadBlockLayer(sysPath, device string) BlockLayer {
+	layer := BlockLayer{
+		Name:   device,
+		Layer:  "physical",
+		Slaves: readSlaves(sysPath, device),
+	}
+	if len(layer.Slaves) > 0 {
+		layer.Layer = "logical"
+	}
+	if data, err := os.ReadFile(filepath.Join(sysPath, "block", device, "dm/name")); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			layer.Name = name
+		}
+	}
+
+	// Holders on the disk or any of its partitions
+	holderDirs, _ := filepath.Glob(filepath.Join(sysPath, "block", device, "*/holders"))
+	holderDirs = append(holderDirs, filepath.Join(sysPath, "block", device, "holders"))
+	for _, dir := range holderDirs {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			layer.Held = true
+			break
+		}
+	}
+	return layer
+}
+
 func GetBlockDeviceInfoMap() map[string]BlockDeviceInfo {
 	deviceInfoOnce.Do(func() {
-		deviceInfoMap = DetectBlockDevices()
+		deviceInfoMap = DetectBlockDevices("/sys")
 	})
 	return deviceInfoMap
 }
 
-func MatchBaseDevice(diskName string, blockDeviceInfoMap map[string]BlockDeviceInfo) (string, bool) {
+// IsPartition uses the kernel's own classification instead of guessing from the name,
+// so nvme0n1p1, md0p1 and mmcblk0p1 are all caught
+func IsPartition(sysPath, name string) bool {
+	_, err := os.Stat(filepath.Join(sysPath, "class/block", name, "partition"))
+	return err == nil
+}
+
+// ParentDevice returns the whole disk a partition belongs to (nvme0n1p1 -> nvme0n1).
+// /sys/class/block/<part> links to .../block/<disk>/<part>
+func ParentDevice(sysPath, name string) (string, bool) {
+	if !IsPartition(sysPath, name) {
+		return "", false
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(sysPath, "class/block", name))
+	if err != nil {
+		return "", false
+	}
+	return filepath.Base(filepath.Dir(target)), true
+}
+
+func MatchBaseDevice(sysPath, diskName string, blockDeviceInfoMap map[string]BlockDeviceInfo) (string, bool) {
 	if _, ok := blockDeviceInfoMap[diskName]; ok {
 		return diskName, true
 	}
 
-	for base := range deviceInfoMap {
-		if strings.HasPrefix(diskName, base) {
-			return base, true
+	// Exact parent lookup, prefix matching would map sdaa onto sda
+	if parent, ok := ParentDevice(sysPath, diskName); ok {
+		if _, ok := blockDeviceInfoMap[parent]; ok {
+			return parent, true
 		}
 	}
 
@@ -0,0 +1,157 @@
+package utility
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fixtureSys builds a /sys tree laid out like the kernel's:
+//
+//	sda        HDD, sda1 is a member of md0
+//	sdaa       SSD, sdaa1 is a member of md0 (must not be confused with sda)
+//	nvme0n1    NVMe with partition nvme0n1p1
+//	md0        RAID1 over sda1 + sdaa1, partitioned into md0p1
+//	dm-0       LVM volume vg0-scratch on md0p1
+//	loop0      ignored
+func fixtureSys(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+
+	mkdir := func(path string) {
+		if err := os.MkdirAll(filepath.Join(root, path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		mkdir(filepath.Dir(path))
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, path string) {
+		mkdir(filepath.Dir(path))
+		if err := os.Symlink(target, filepath.Join(root, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	disk := func(name, rotational string, parts ...string) {
+		dev := "devices/virtual/block/" + name
+		write(dev+"/queue/rotational", rotational)
+		mkdir(dev + "/holders")
+		link("../"+dev, "block/"+name)
+		link("../../"+dev, "class/block/"+name)
+		for _, part := range parts {
+			write(dev+"/"+part+"/partition", "1")
+			mkdir(dev + "/" + part + "/holders")
+			link("../../"+dev+"/"+part, "class/block/"+part)
+		}
+	}
+	hold := func(holder, member, memberDir string) {
+		// member appears in holder/slaves, holder appears in member/holders
+		link("../../"+memberDir, "devices/virtual/block/"+holder+"/slaves/"+member)
+		write(memberDir+"/holders/"+holder, "")
+	}
+
+	disk("sda", "1", "sda1")
+	disk("sdaa", "0", "sdaa1")
+	disk("nvme0n1", "0", "nvme0n1p1")
+	link("../../../class/nvme", "devices/virtual/block/nvme0n1/device/subsystem")
+	disk("md0", "0", "md0p1")
+	disk("dm-0", "0")
+	write("devices/virtual/block/dm-0/dm/name", "vg0-scratch\n")
+	disk("loop0", "0")
+
+	hold("md0", "sda1", "devices/virtual/block/sda/sda1")
+	hold("md0", "sdaa1", "devices/virtual/block/sdaa/sdaa1")
+	hold("dm-0", "md0p1", "devices/virtual/block/md0/md0p1")
+	return root
+}
+
+func TestIsPartition(t *testing.T) {
+	sys := fixtureSys(t)
+	for name, want := range map[string]bool{
+		"sda": false, "sda1": true,
+		"sdaa": false, "sdaa1": true,
+		"nvme0n1": false, "nvme0n1p1": true,
+		"md0": false, "md0p1": true,
+		"dm-0": false, "missing": false,
+	} {
+		if got := IsPartition(sys, name); got != want {
+			t.Errorf("IsPartition(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestParentDevice(t *testing.T) {
+	sys := fixtureSys(t)
+	for part, want := range map[string]string{
+		"sda1":      "sda",
+		"sdaa1":     "sdaa",
+		"nvme0n1p1": "nvme0n1",
+		"md0p1":     "md0",
+	} {
+		if got, ok := ParentDevice(sys, part); !ok || got != want {
+			t.Errorf("ParentDevice(%s) = %q, %v, want %q", part, got, ok, want)
+		}
+	}
+	if _, ok := ParentDevice(sys, "sda"); ok {
+		t.Error("ParentDevice(sda) should fail for a whole disk")
+	}
+}
+
+func TestDetectBlockDevices(t *testing.T) {
+	devices := DetectBlockDevices(fixtureSys(t))
+	want := map[string]BlockDeviceInfo{
+		"sda":     {Type: "HDD", Rotational: true},
+		"sdaa":    {Type: "SSD"},
+		"nvme0n1": {Type: "NVMe"},
+		// Arrays take the slowest member, dm-0 gets it through md0p1 -> md0
+		"md0":  {Type: "HDD", Rotational: true},
+		"dm-0": {Type: "HDD", Rotational: true},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("DetectBlockDevices = %+v\nwant %+v", devices, want)
+	}
+}
+
+func TestMatchBaseDevice(t *testing.T) {
+	sys := fixtureSys(t)
+	devices := DetectBlockDevices(sys)
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"sdaa", "sdaa", true}, // Prefix matching used to return sda
+		{"sdaa1", "sdaa", true},
+		{"sda1", "sda", true},
+		{"nvme0n1p1", "nvme0n1", true},
+		{"md0p1", "md0", true},
+		{"dm-0", "dm-0", true},
+		{"sdab", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := MatchBaseDevice(sys, tt.name, devices)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("MatchBaseDevice(%s) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestReadBlockLayer(t *testing.T) {
+	sys := fixtureSys(t)
+	tests := map[string]BlockLayer{
+		"sda":     {Name: "sda", Layer: "physical", Held: true},
+		"nvme0n1": {Name: "nvme0n1", Layer: "physical"},
+		"md0":     {Name: "md0", Layer: "logical", Slaves: []string{"sda", "sdaa"}, Held: true},
+		"dm-0":    {Name: "vg0-scratch", Layer: "logical", Slaves: []string{"md0"}},
+	}
+	for device, want := range tests {
+		if got := ReadBlockLayer(sys, device); !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadBlockLayer(%s) = %+v, want %+v", device, got, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package utility
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Optional cpuset file limiting the CPUs jobs can use, e.g.
+// /sys/fs/cgroup/cpuset/slurm/cpuset.cpus (v1) or
+// /sys/fs/cgroup/system.slice/slurmstepd.scope/cpuset.cpus.effective (v2)
+var SlurmCpusetPath string
+
+// CPUCapacity is the node's real CPU capacity, independent of the exporter's own affinity mask
+type CPUCapacity struct {
+	Online   []int
+	Isolated []int
+	Usable   []int // Online, not isolated, and inside the Slurm cpuset when configured
+}
+
+// GetCPUCapacity is re-read on each call so CPU hotplug is picked up
+func GetCPUCapacity() CPUCapacity {
+	return ReadCPUCapacity("/sys", SlurmCpusetPath)
+}
+
+func ReadCPUCapacity(sysPath, cpusetPath string) CPUCapacity {
+	var capacity CPUCapacity
+	if data, err := os.ReadFile(filepath.Join(sysPath, "devices/system/cpu/online")); err == nil {
+		capacity.Online = ParseCPUList(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(sysPath, "devices/system/cpu/isolated")); err == nil {
+		capacity.Isolated = ParseCPUList(string(data))
+	}
+
+	excluded := make(map[int]struct{})
+	for _, cpu := range capacity.Isolated {
+		excluded[cpu] = struct{}{}
+	}
+
+	var allowed map[int]struct{}
+	if cpusetPath != "" {
+		if data, err := os.ReadFile(cpusetPath); err == nil {
+			allowed = make(map[int]struct{})
+			for _, cpu := range ParseCPUList(string(data)) {
+				allowed[cpu] = struct{}{}
+			}
+		}
+	}
+
+	for _, cpu := range capacity.Online {
+		if _, ok := excluded[cpu]; ok {
+			continue
+		}
+		if allowed != nil {
+			if _, ok := allowed[cpu]; !ok {
+				continue
+			}
+		}
+		capacity.Usable = append(capacity.Usable, cpu)
+	}
+	sort.Ints(capacity.Usable)
+	return capacity
+}
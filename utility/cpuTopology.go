@@ -0,0 +1,95 @@
+package utility
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CPUTopology places one logical CPU on its NUMA node and physical core
+type CPUTopology struct {
+	Node    int
+	Package int
+	Core    int
+}
+
+var (
+	cpuTopologyOnce sync.Once
+	cpuTopology     map[int]CPUTopology
+)
+
+// GetCPUTopology maps logical CPU index -> topology. CPUs without a NUMA node land on node 0
+func GetCPUTopology() map[int]CPUTopology {
+	cpuTopologyOnce.Do(func() {
+		cpuTopology = DetectCPUTopology("/sys")
+	})
+	return cpuTopology
+}
+
+func DetectCPUTopology(sysPath string) map[int]CPUTopology {
+	topology := make(map[int]CPUTopology)
+
+	cpuDirs, _ := filepath.Glob(filepath.Join(sysPath, "devices/system/cpu/cpu[0-9]*"))
+	for _, dir := range cpuDirs {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "cpu"))
+		if err != nil {
+			continue
+		}
+		pkg, _ := readIntFile(filepath.Join(dir, "topology/physical_package_id"))
+		core, _ := readIntFile(filepath.Join(dir, "topology/core_id"))
+		topology[cpu] = CPUTopology{Package: pkg, Core: core}
+	}
+
+	nodeDirs, _ := filepath.Glob(filepath.Join(sysPath, "devices/system/node/node[0-9]*"))
+	for _, dir := range nodeDirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			continue
+		}
+		for _, cpu := range ParseCPUList(string(data)) {
+			t := topology[cpu]
+			t.Node = node
+			topology[cpu] = t
+		}
+	}
+	return topology
+}
+
+// ParseCPUList expands the kernel list format ("0-3,8,10-11") into CPU indices
+func ParseCPUList(list string) []int {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			continue
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil {
+				continue
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+func readIntFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,257 @@
+package utility
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/procfs/sysfs"
+)
+
+// AMDBackend reads amdgpu cards from sysfs
+type AMDBackend struct {
+	sysPath string
+}
+
+func NewAMDBackend(sysPath string) *AMDBackend {
+	return &AMDBackend{sysPath: sysPath}
+}
+
+func (b *AMDBackend) Name() string {
+	return "amd"
+}
+
+func (b *AMDBackend) Detect() (int, error) {
+	fs, err := sysfs.NewFS(b.sysPath)
+	if err != nil {
+		return 0, err
+	}
+
+	gpuStats, err := fs.ClassDRMCardAMDGPUStats()
+	if err != nil || len(gpuStats) == 0 {
+		return 0, err
+	}
+
+	// Edge case check. Ensure we have actual GPU hardware
+	validCount := 0
+	for _, card := range gpuStats {
+		if card.MemoryVRAMSize > 0 {
+			validCount++
+		}
+	}
+
+	return validCount, nil
+}
+
+func (b *AMDBackend) Sample() ([]GPUDevice, error) {
+	fs, err := sysfs.NewFS(b.sysPath)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := fs.ClassDRMCardAMDGPUStats()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []GPUDevice
+	for _, card := range stats {
+		// Edge case where we have no physical GPU
+		if card.MemoryVRAMSize == 0 {
+			continue
+		}
+
+		hwmon := b.hwmonPath(card.Name)
+		deviceDir := filepath.Join(b.sysPath, "class/drm", card.Name, "device")
+		devices = append(devices, GPUDevice{
+			Card:            card.Name,
+			ID:              card.UniqueID,
+			BusyPercent:     float64(card.GPUBusyPercent),
+			VRAMSize:        card.MemoryVRAMSize,
+			VRAMUsed:        card.MemoryVRAMUsed,
+			VisibleVRAMSize: card.MemoryVisibleVRAMSize,
+			VisibleVRAMUsed: card.MemoryVisibleVRAMUsed,
+			GTTSize:         card.MemoryGTTSize,
+			GTTUsed:         card.MemoryGTTUsed,
+			PowerWatts:      readHwmonPower(hwmon),
+			Temperatures:    readHwmonTemperatures(hwmon),
+			SclkHz:          readSclk(deviceDir, hwmon),
+			MemBusyPercent:  readMemBusy(deviceDir),
+			PCIe:            ReadPCIeLink(deviceDir),
+			ECCErrors:       readRASErrors(deviceDir),
+			Throttle:        readHwmonThrottle(hwmon),
+		})
+	}
+	return devices, nil
+}
+
+// hwmonPath returns the first hwmon directory under the card, or "" if there is none
+func (b *AMDBackend) hwmonPath(card string) string {
+	matches, _ := filepath.Glob(filepath.Join(b.sysPath, "class/drm", card, "device/hwmon/hwmon*"))
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
+
+// power1_average is in microwatts
+func readHwmonPower(hwmon string) float64 {
+	if hwmon == "" {
+		return math.NaN()
+	}
+	microwatts, err := readUintFile(filepath.Join(hwmon, "power1_average"))
+	if err != nil {
+		return math.NaN()
+	}
+	return float64(microwatts) / 1e6
+}
+
+// temp*_input is in millidegrees, temp*_label names the sensor (edge, junction, mem)
+func readHwmonTemperatures(hwmon string) map[string]float64 {
+	temps := make(map[string]float64)
+	if hwmon == "" {
+		return temps
+	}
+	inputs, _ := filepath.Glob(filepath.Join(hwmon, "temp*_input"))
+	for _, input := range inputs {
+		millidegrees, err := readUintFile(input)
+		if err != nil {
+			continue
+		}
+		prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+		sensor := prefix
+		if label, err := os.ReadFile(filepath.Join(hwmon, prefix+"_label")); err == nil {
+			sensor = strings.TrimSpace(string(label))
+		}
+		temps[sensor] = float64(millidegrees) / 1000
+	}
+	return temps
+}
+
+// readSclk prefers the active pp_dpm_sclk level and falls back to the hwmon sclk reading
+func readSclk(deviceDir, hwmon string) float64 {
+	if data, err := os.ReadFile(filepath.Join(deviceDir, "pp_dpm_sclk")); err == nil {
+		if hz, ok := parseActiveDPMLevel(string(data)); ok {
+			return hz
+		}
+	}
+	if hwmon == "" {
+		return math.NaN()
+	}
+	inputs, _ := filepath.Glob(filepath.Join(hwmon, "freq*_input"))
+	for _, input := range inputs {
+		prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+		label, err := os.ReadFile(filepath.Join(hwmon, prefix+"_label"))
+		if err != nil || strings.TrimSpace(string(label)) != "sclk" {
+			continue
+		}
+		// freq*_input is already in Hz
+		if hz, err := readUintFile(input); err == nil {
+			return float64(hz)
+		}
+	}
+	return math.NaN()
+}
+
+// parseActiveDPMLevel reads lines like "1: 1800Mhz *" and returns the starred level in Hz
+func parseActiveDPMLevel(data string) (float64, bool) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[len(fields)-1] != "*" {
+			continue
+		}
+		freq := strings.ToLower(fields[1])
+		var multiplier float64
+		switch {
+		case strings.HasSuffix(freq, "mhz"):
+			multiplier = 1e6
+		case strings.HasSuffix(freq, "khz"):
+			multiplier = 1e3
+		default:
+			continue
+		}
+		value, err := strconv.ParseFloat(freq[:len(freq)-3], 64)
+		if err != nil {
+			continue
+		}
+		return value * multiplier, true
+	}
+	return 0, false
+}
+
+func readMemBusy(deviceDir string) float64 {
+	busy, err := readUintFile(filepath.Join(deviceDir, "mem_busy_percent"))
+	if err != nil {
+		return math.NaN()
+	}
+	return float64(busy)
+}
+
+// readRASErrors parses ras/<block>_err_count files, each holding "ue: N" and "ce: N" lines
+func readRASErrors(deviceDir string) map[string]ECCCount {
+	errors := make(map[string]ECCCount)
+	files, _ := filepath.Glob(filepath.Join(deviceDir, "ras/*_err_count"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var count ECCCount
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			switch strings.TrimSpace(key) {
+			case "ue":
+				count.Uncorrectable = n
+			case "ce":
+				count.Correctable = n
+			}
+		}
+		errors[strings.TrimSuffix(filepath.Base(file), "_err_count")] = count
+	}
+	return errors
+}
+
+// readHwmonThrottle infers throttling from hwmon limits. amdgpu only reports the real
+// throttle status inside the binary gpu_metrics blob, whose layout changes per ASIC
+func readHwmonThrottle(hwmon string) map[string]bool {
+	throttle := make(map[string]bool)
+	if hwmon == "" {
+		return throttle
+	}
+
+	// Power: average draw at the cap
+	if power, err := readUintFile(filepath.Join(hwmon, "power1_average")); err == nil {
+		if limit, err := readUintFile(filepath.Join(hwmon, "power1_cap")); err == nil && limit > 0 {
+			throttle["power"] = float64(power) >= 0.98*float64(limit)
+		}
+	}
+
+	// Thermal: any sensor at or past its critical limit
+	inputs, _ := filepath.Glob(filepath.Join(hwmon, "temp*_input"))
+	thermal := false
+	for _, input := range inputs {
+		prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+		temp, err := readUintFile(input)
+		if err != nil {
+			continue
+		}
+		if crit, err := readUintFile(filepath.Join(hwmon, prefix+"_crit")); err == nil && crit > 0 && temp >= crit {
+			thermal = true
+		}
+	}
+	throttle["thermal"] = thermal
+	return throttle
+}
+
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
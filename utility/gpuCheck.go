@@ -1,49 +1,131 @@
 package utility
 
 import (
+	"log"
 	"sync"
-
-	"github.com/prometheus/procfs/sysfs"
+	"time"
 )
 
+// GPUDevice is a single vendor-neutral GPU sample
+type GPUDevice struct {
+	Card string // Label used for the card (card0, nvidia0, ...)
+	ID   string // Unique ID that persists across machines
+
+	BusyPercent float64 // Engine busy (0-100)
+	VRAMSize    uint64  // Bytes
+	VRAMUsed    uint64  // Bytes
+
+	// Optional. Zero when the vendor has no equivalent
+	VisibleVRAMSize, VisibleVRAMUsed uint64
+	GTTSize, GTTUsed                 uint64
+
+	PowerWatts     float64            // NaN when not reported
+	Temperatures   map[string]float64 // Sensor name -> degrees Celsius
+	SclkHz         float64            // Shader/SM clock, NaN when not reported
+	MemBusyPercent float64            // Memory bandwidth busy (0-100), NaN when not reported
+
+	PCIe      PCIeLink
+	ECCErrors map[string]ECCCount // Block (umc, gfx, ... or total) -> cumulative counts
+	Throttle  map[string]bool     // Reason (power, thermal, hardware) -> currently throttling
+}
+
+type PCIeLink struct {
+	CurrentSpeedGTs, MaxSpeedGTs float64 // Zero when unknown
+	CurrentWidth, MaxWidth       int
+}
+
+type ECCCount struct {
+	Correctable, Uncorrectable uint64
+}
+
+// Degraded reports GPUs that shouldn't count towards node capacity.
+// Link speed is left out since GPUs drop it at idle to save power.
+func (d GPUDevice) Degraded() bool {
+	for _, count := range d.ECCErrors {
+		if count.Uncorrectable > 0 {
+			return true
+		}
+	}
+	return d.PCIe.MaxWidth > 0 && d.PCIe.CurrentWidth > 0 && d.PCIe.CurrentWidth < d.PCIe.MaxWidth
+}
+
+// GPUBackend is implemented once per vendor. Detection, metrics and the score all go through it
+type GPUBackend interface {
+	Name() string
+	// Detect returns the number of usable GPUs (0 if this vendor isn't present).
+	// A partial count may come with an error when some cards could not be read
+	Detect() (int, error)
+	// Sample reads the current state of every usable GPU. Like Detect, the cards that
+	// could be read are returned alongside an error
+	Sample() ([]GPUDevice, error)
+}
+
+// Tried in order, first backend that detects devices wins
+var GPUBackends = []GPUBackend{
+	NewAMDBackend("/sys"),
+	NewNVIDIABackend(nil),
+}
+
+// How often GPUs are re-detected so a card that falls off the bus or gets
+// reset changes the node's scoring without an exporter restart
+var GPURedetectInterval = time.Minute
+
 var (
-	gpuConfigOnce sync.Once
-	gpuNode       bool
-	gpuCount      int
+	gpuConfigMu sync.Mutex
+	gpuDetected time.Time
+	gpuNode     bool
+	gpuCount    int
+	gpuBackend  GPUBackend
 )
 
 func GetGPUConfig() (bool, int) {
-	gpuConfigOnce.Do(func() {
-		fs, err := sysfs.NewFS("/sys")
-		if err != nil {
-			gpuNode = false
-			gpuCount = 0
-			return
-		}
+	gpuConfigMu.Lock()
+	defer gpuConfigMu.Unlock()
+	refreshGPUConfig()
+	return gpuNode, gpuCount
+}
 
-		gpuStats, err := fs.ClassDRMCardAMDGPUStats()
-		if err != nil || len(gpuStats) == 0 {
-			gpuNode = false
-			gpuCount = 0
-			return
-		}
+// GetGPUBackend returns the detected backend, or nil on CPU nodes
+func GetGPUBackend() GPUBackend {
+	gpuConfigMu.Lock()
+	defer gpuConfigMu.Unlock()
+	refreshGPUConfig()
+	return gpuBackend
+}
 
-		// Edge case check. Ensure we have actual GPU hardware
-		validCount := 0
-		for _, card := range gpuStats {
-			if card.MemoryVRAMSize > 0 {
-				validCount++
-			}
+// refreshGPUConfig re-runs detection once GPURedetectInterval has passed. Caller holds gpuConfigMu
+func refreshGPUConfig() {
+	if !gpuDetected.IsZero() && time.Since(gpuDetected) < GPURedetectInterval {
+		return
+	}
+	gpuDetected = time.Now()
+
+	prevCount := gpuCount
+	detectGPUs()
+	if gpuCount != prevCount {
+		if gpuBackend != nil {
+			log.Printf("INFO: Detected %d %s GPUs", gpuCount, gpuBackend.Name())
+		} else {
+			log.Printf("INFO: No GPUs detected")
 		}
+	}
+}
 
-		if validCount == 0 {
-			gpuNode = false
-			gpuCount = 0
+func detectGPUs() {
+	for _, backend := range GPUBackends {
+		count, err := backend.Detect()
+		if err != nil && count == 0 && backend == gpuBackend {
+			// The vendor we already use failed outright (e.g. nvidia-smi erroring after a card
+			// fell off the bus). Keep it so Sample can still report the remaining cards
+			log.Printf("WARNING: %s GPU detection failed, keeping previous config: %v", backend.Name(), err)
 			return
 		}
-
-		gpuNode = true
-		gpuCount = len(gpuStats)
-	})
-	return gpuNode, gpuCount
+		// Partial results (count > 0 with an error) still mean this vendor is present
+		if count == 0 {
+			continue
+		}
+		gpuNode, gpuCount, gpuBackend = true, count, backend
+		return
+	}
+	gpuNode, gpuCount, gpuBackend = false, 0, nil
 }
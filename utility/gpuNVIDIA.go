@@ -0,0 +1,241 @@
+package utility
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandRunner runs an external command and returns its stdout.
+// Swapped out in tests to replay recorded output.
+type CommandRunner func(name string, args ...string) ([]byte, error)
+
+// Fields requested from nvidia-smi on every sample, in column order.
+// All of these are supported by every driver we run
+var nvidiaQueryFields = []string{
+	"index", "uuid", "utilization.gpu", "memory.total", "memory.used", "power.draw", "temperature.gpu",
+	"clocks.sm", "utilization.memory",
+}
+
+// Health fields are queried separately. nvidia-smi rejects the whole query if one field is
+// unknown to the installed driver, so each is probed once and unsupported ones are dropped
+var nvidiaHealthFields = []string{
+	"pcie.link.gen.current", "pcie.link.gen.max", "pcie.link.width.current", "pcie.link.width.max",
+	"ecc.errors.corrected.volatile.total", "ecc.errors.uncorrected.volatile.total",
+	"clocks_throttle_reasons.sw_power_cap", "clocks_throttle_reasons.hw_power_brake_slowdown",
+	"clocks_throttle_reasons.sw_thermal_slowdown", "clocks_throttle_reasons.hw_thermal_slowdown",
+	"clocks_throttle_reasons.hw_slowdown",
+}
+
+// How long a driver that supports none of the health fields goes before they're probed again
+var nvidiaHealthReprobeInterval = 10 * time.Minute
+
+// nvidia-smi throttle reason field -> reason label shared with other vendors
+var nvidiaThrottleReasons = map[string]string{
+	"clocks_throttle_reasons.sw_power_cap":            "power",
+	"clocks_throttle_reasons.hw_power_brake_slowdown": "power",
+	"clocks_throttle_reasons.sw_thermal_slowdown":     "thermal",
+	"clocks_throttle_reasons.hw_thermal_slowdown":     "thermal",
+	"clocks_throttle_reasons.hw_slowdown":             "hardware",
+}
+
+// PCIe generation -> GT/s per lane
+var pcieGenSpeeds = map[string]float64{
+	"1": 2.5, "2": 5, "3": 8, "4": 16, "5": 32, "6": 64,
+}
+
+// NVIDIABackend parses nvidia-smi CSV query output
+type NVIDIABackend struct {
+	run CommandRunner
+
+	healthMu     sync.Mutex
+	healthFields []string  // Supported health fields
+	healthProbed time.Time // Zero until probed
+}
+
+// NewNVIDIABackend uses the real nvidia-smi when run is nil
+func NewNVIDIABackend(run CommandRunner) *NVIDIABackend {
+	if run == nil {
+		run = RunWithTimeout
+	}
+	return &NVIDIABackend{run: run}
+}
+
+func (b *NVIDIABackend) Name() string {
+	return "nvidia"
+}
+
+// Detect only asks for what it needs so a driver missing some fields still counts as a GPU node
+func (b *NVIDIABackend) Detect() (int, error) {
+	// Rows for the healthy cards come back even when one card makes nvidia-smi fail
+	output, err := b.query([]string{"index", "memory.total"})
+	count := 0
+	for _, row := range parseNvidiaCSV(output, []string{"index", "memory.total"}) {
+		// Same rule as Sample, cards without memory are skipped
+		if totalMiB, _ := strconv.ParseUint(row["memory.total"], 10, 64); totalMiB > 0 {
+			count++
+		}
+	}
+	return count, err
+}
+
+func (b *NVIDIABackend) Sample() ([]GPUDevice, error) {
+	output, err := b.query(nvidiaQueryFields)
+	devices := parseNvidiaSmi(output)
+	if err != nil {
+		// Whatever rows were printed before the failure are still good
+		return devices, err
+	}
+
+	// Health is best effort, a failure here leaves the core metrics intact
+	if fields := b.supportedHealthFields(); len(fields) > 0 {
+		fields = append([]string{"index"}, fields...)
+		if output, err := b.query(fields); err == nil {
+			applyNvidiaHealth(devices, parseNvidiaCSV(output, fields))
+		}
+	}
+	return devices, nil
+}
+
+func (b *NVIDIABackend) query(fields []string) (string, error) {
+	output, err := b.run("nvidia-smi",
+		"--query-gpu="+strings.Join(fields, ","),
+		"--format=csv,noheader,nounits",
+	)
+	return string(output), err
+}
+
+// supportedHealthFields probes each health field on first use
+func (b *NVIDIABackend) supportedHealthFields() []string {
+	b.healthMu.Lock()
+	defer b.healthMu.Unlock()
+
+	// Sample only gets here after the core query worked, so nothing supported means the
+	// driver is too old rather than nvidia-smi being down. Probing is 11 nvidia-smi runs,
+	// so that answer is kept too and only rechecked now and then (e.g. after a driver upgrade)
+	if !b.healthProbed.IsZero() &&
+		(len(b.healthFields) > 0 || time.Since(b.healthProbed) < nvidiaHealthReprobeInterval) {
+		return b.healthFields
+	}
+	var supported []string
+	for _, field := range nvidiaHealthFields {
+		if _, err := b.query([]string{"index", field}); err == nil {
+			supported = append(supported, field)
+		}
+	}
+	b.healthFields = supported
+	b.healthProbed = time.Now()
+	return supported
+}
+
+// parseNvidiaCSV maps each row to field -> value. Rows with the wrong column count
+// (nvidia-smi error lines) are skipped
+func parseNvidiaCSV(output string, fields []string) []map[string]string {
+	var rows []map[string]string
+	for _, line := range strings.Split(output, "\n") {
+		values := strings.Split(line, ",")
+		if len(values) != len(fields) {
+			continue
+		}
+		row := make(map[string]string, len(fields))
+		for i, field := range fields {
+			row[field] = strings.TrimSpace(values[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func parseNvidiaSmi(output string) []GPUDevice {
+	var devices []GPUDevice
+	for _, row := range parseNvidiaCSV(output, nvidiaQueryFields) {
+		// Unsupported fields come back as "[N/A]" and parse as zero
+		busy, _ := strconv.ParseFloat(row["utilization.gpu"], 64)
+		totalMiB, _ := strconv.ParseUint(row["memory.total"], 10, 64)
+		usedMiB, _ := strconv.ParseUint(row["memory.used"], 10, 64)
+		if totalMiB == 0 {
+			continue
+		}
+
+		power, err := strconv.ParseFloat(row["power.draw"], 64)
+		if err != nil {
+			power = math.NaN()
+		}
+		temps := make(map[string]float64)
+		if temp, err := strconv.ParseFloat(row["temperature.gpu"], 64); err == nil {
+			temps["gpu"] = temp
+		}
+		sclk := math.NaN()
+		if mhz, err := strconv.ParseFloat(row["clocks.sm"], 64); err == nil {
+			sclk = mhz * 1e6
+		}
+		// utilization.memory is memory controller busy, the same idea as AMD mem_busy_percent
+		memBusy, err := strconv.ParseFloat(row["utilization.memory"], 64)
+		if err != nil {
+			memBusy = math.NaN()
+		}
+
+		devices = append(devices, GPUDevice{
+			Card:           "nvidia" + row["index"],
+			ID:             row["uuid"],
+			BusyPercent:    busy,
+			VRAMSize:       totalMiB * 1024 * 1024,
+			VRAMUsed:       usedMiB * 1024 * 1024,
+			PowerWatts:     power,
+			Temperatures:   temps,
+			SclkHz:         sclk,
+			MemBusyPercent: memBusy,
+			ECCErrors:      make(map[string]ECCCount),
+			Throttle:       make(map[string]bool),
+		})
+	}
+	return devices
+}
+
+// applyNvidiaHealth fills PCIe, ECC and throttle state from the health query, matched by index.
+// Fields missing from the rows (unsupported) leave their defaults
+func applyNvidiaHealth(devices []GPUDevice, rows []map[string]string) {
+	byCard := make(map[string]map[string]string)
+	for _, row := range rows {
+		byCard["nvidia"+row["index"]] = row
+	}
+
+	for i := range devices {
+		row, ok := byCard[devices[i].Card]
+		if !ok {
+			continue
+		}
+
+		link := &devices[i].PCIe
+		link.CurrentSpeedGTs = pcieGenSpeeds[row["pcie.link.gen.current"]]
+		link.MaxSpeedGTs = pcieGenSpeeds[row["pcie.link.gen.max"]]
+		link.CurrentWidth, _ = strconv.Atoi(row["pcie.link.width.current"])
+		link.MaxWidth, _ = strconv.Atoi(row["pcie.link.width.max"])
+
+		// ECC is [N/A] on consumer cards
+		corrected, cErr := strconv.ParseUint(row["ecc.errors.corrected.volatile.total"], 10, 64)
+		uncorrected, uErr := strconv.ParseUint(row["ecc.errors.uncorrected.volatile.total"], 10, 64)
+		if cErr == nil || uErr == nil {
+			devices[i].ECCErrors["total"] = ECCCount{Correctable: corrected, Uncorrectable: uncorrected}
+		}
+
+		for name, reason := range nvidiaThrottleReasons {
+			value, ok := row[name]
+			if !ok {
+				continue
+			}
+			devices[i].Throttle[reason] = devices[i].Throttle[reason] || value == "Active"
+		}
+	}
+}
+
+// RunWithTimeout is the default CommandRunner
+func RunWithTimeout(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return exec.CommandContext(ctx, name, args...).Output()
+}
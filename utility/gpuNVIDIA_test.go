@@ -0,0 +1,221 @@
+package utility
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// fakeNvidiaSmi answers --query-gpu like nvidia-smi does: the whole query fails if any field is unsupported
+type fakeNvidiaSmi struct {
+	rows        []map[string]string // Field -> value per GPU
+	unsupported map[string]bool
+	fail        bool
+	calls       int
+}
+
+func (f *fakeNvidiaSmi) run(name string, args ...string) ([]byte, error) {
+	f.calls++
+	if f.fail {
+		return nil, errors.New("exit status 9")
+	}
+	var fields []string
+	for _, arg := range args {
+		if query, ok := strings.CutPrefix(arg, "--query-gpu="); ok {
+			fields = strings.Split(query, ",")
+		}
+	}
+	for _, field := range fields {
+		if f.unsupported[field] {
+			return []byte("Field \"" + field + "\" is not a valid field to query.\n"), errors.New("exit status 2")
+		}
+	}
+
+	var out strings.Builder
+	for _, row := range f.rows {
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			values[i] = row[field]
+			if values[i] == "" {
+				values[i] = "[N/A]"
+			}
+		}
+		out.WriteString(strings.Join(values, ", ") + "\n")
+	}
+	return []byte(out.String()), nil
+}
+
+var fakeA100 = map[string]string{
+	"index": "0", "uuid": "GPU-a", "utilization.gpu": "87", "memory.total": "40960", "memory.used": "20480",
+	"power.draw": "250.5", "temperature.gpu": "61", "clocks.sm": "1410", "utilization.memory": "40",
+	"pcie.link.gen.current": "4", "pcie.link.gen.max": "4", "pcie.link.width.current": "8", "pcie.link.width.max": "16",
+	"ecc.errors.corrected.volatile.total": "3", "ecc.errors.uncorrected.volatile.total": "0",
+	"clocks_throttle_reasons.sw_power_cap":        "Active",
+	"clocks_throttle_reasons.sw_thermal_slowdown": "Not Active",
+}
+
+func TestNVIDIADetectIgnoresHealthFields(t *testing.T) {
+	fake := &fakeNvidiaSmi{
+		rows:        []map[string]string{fakeA100},
+		unsupported: map[string]bool{"clocks_throttle_reasons.hw_power_brake_slowdown": true},
+	}
+	count, err := NewNVIDIABackend(fake.run).Detect()
+	if err != nil || count != 1 {
+		t.Fatalf("Detect() = %d, %v, want 1, nil", count, err)
+	}
+}
+
+func TestNVIDIASampleDropsUnsupportedHealthFields(t *testing.T) {
+	fake := &fakeNvidiaSmi{
+		rows: []map[string]string{fakeA100},
+		unsupported: map[string]bool{
+			"clocks_throttle_reasons.hw_power_brake_slowdown": true,
+			"ecc.errors.uncorrected.volatile.total":           true,
+		},
+	}
+	backend := NewNVIDIABackend(fake.run)
+
+	devices, err := backend.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(devices))
+	}
+	d := devices[0]
+	if d.BusyPercent != 87 {
+		t.Errorf("BusyPercent = %v, want 87", d.BusyPercent)
+	}
+	if d.PCIe.CurrentWidth != 8 || d.PCIe.MaxWidth != 16 || d.PCIe.CurrentSpeedGTs != 16 {
+		t.Errorf("PCIe = %+v", d.PCIe)
+	}
+	if !d.Degraded() {
+		t.Error("x8 link on an x16 card should be degraded")
+	}
+	if got := d.ECCErrors["total"]; got.Correctable != 3 || got.Uncorrectable != 0 {
+		t.Errorf("ECC = %+v, want 3 correctable", got)
+	}
+	if !d.Throttle["power"] || d.Throttle["thermal"] {
+		t.Errorf("Throttle = %v, want power only", d.Throttle)
+	}
+
+	// Probing happens once, later samples are two queries
+	before := fake.calls
+	if _, err := backend.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.calls - before; got != 2 {
+		t.Errorf("second Sample made %d queries, want 2", got)
+	}
+}
+
+func TestNVIDIASampleSurvivesHealthFailure(t *testing.T) {
+	fake := &fakeNvidiaSmi{rows: []map[string]string{fakeA100}, unsupported: make(map[string]bool)}
+	for _, field := range nvidiaHealthFields {
+		fake.unsupported[field] = true
+	}
+
+	backend := NewNVIDIABackend(fake.run)
+
+	devices, err := backend.Sample()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("Sample() = %d devices, %v", len(devices), err)
+	}
+	if devices[0].PCIe != (PCIeLink{}) || len(devices[0].ECCErrors) != 0 || len(devices[0].Throttle) != 0 {
+		t.Errorf("unsupported health fields should leave defaults, got %+v", devices[0])
+	}
+
+	// Nothing supported is remembered, later samples are just the core query
+	before := fake.calls
+	if _, err := backend.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.calls - before; got != 1 {
+		t.Errorf("second Sample made %d queries, want 1", got)
+	}
+
+	// Until the reprobe interval passes
+	prev := nvidiaHealthReprobeInterval
+	nvidiaHealthReprobeInterval = 0
+	t.Cleanup(func() { nvidiaHealthReprobeInterval = prev })
+	before = fake.calls
+	if _, err := backend.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.calls-before, 1+len(nvidiaHealthFields); got != want {
+		t.Errorf("Sample after the reprobe interval made %d queries, want %d", got, want)
+	}
+}
+
+// Recorded from nvidia-smi --query-gpu=<nvidiaQueryFields> --format=csv,noheader,nounits on a mixed
+// node: an A100, a T4 without power readings, and a display-only card reporting no memory
+const recordedNvidiaSmi = `0, GPU-8f6a1c2e-7b3d-4e1a-9c0f-1a2b3c4d5e6f, 87, 40960, 20480, 250.53, 61, 1410, 40
+1, GPU-1d2e3f4a-5b6c-7d8e-9f0a-b1c2d3e4f5a6, 0, 15360, 3, [N/A], 34, 300, [N/A]
+2, GPU-00000000-0000-0000-0000-000000000000, [N/A], 0, 0, [N/A], [N/A], [N/A], [N/A]
+`
+
+func TestParseNvidiaSmiRecorded(t *testing.T) {
+	devices := parseNvidiaSmi(recordedNvidiaSmi)
+	if len(devices) != 2 {
+		t.Fatalf("got %d devices, want 2 (zero-memory row skipped)", len(devices))
+	}
+
+	a100 := devices[0]
+	if a100.Card != "nvidia0" || a100.ID != "GPU-8f6a1c2e-7b3d-4e1a-9c0f-1a2b3c4d5e6f" {
+		t.Errorf("card/id = %s/%s", a100.Card, a100.ID)
+	}
+	if a100.BusyPercent != 87 || a100.VRAMSize != 40960*1024*1024 || a100.VRAMUsed != 20480*1024*1024 {
+		t.Errorf("busy/vram = %v/%d/%d", a100.BusyPercent, a100.VRAMSize, a100.VRAMUsed)
+	}
+	if a100.PowerWatts != 250.53 || a100.Temperatures["gpu"] != 61 || a100.SclkHz != 1410e6 || a100.MemBusyPercent != 40 {
+		t.Errorf("power/temp/sclk/membusy = %v/%v/%v/%v", a100.PowerWatts, a100.Temperatures, a100.SclkHz, a100.MemBusyPercent)
+	}
+
+	// [N/A] becomes NaN (unknown) rather than a real-looking zero
+	t4 := devices[1]
+	if t4.Card != "nvidia1" || t4.VRAMSize != 15360*1024*1024 {
+		t.Errorf("T4 card/vram = %s/%d", t4.Card, t4.VRAMSize)
+	}
+	if !math.IsNaN(t4.PowerWatts) || !math.IsNaN(t4.MemBusyPercent) {
+		t.Errorf("T4 power/membusy = %v/%v, want NaN", t4.PowerWatts, t4.MemBusyPercent)
+	}
+	if t4.Temperatures["gpu"] != 34 {
+		t.Errorf("T4 temp = %v", t4.Temperatures)
+	}
+}
+
+func TestParseNvidiaSmiSkipsErrorLines(t *testing.T) {
+	output := "Unable to determine the device handle for GPU 0000:3B:00.0: Unknown Error\n" + recordedNvidiaSmi
+	if devices := parseNvidiaSmi(output); len(devices) != 2 {
+		t.Fatalf("got %d devices, want 2", len(devices))
+	}
+}
+
+func TestNVIDIAKeepsRowsWhenOneCardFails(t *testing.T) {
+	run := func(name string, args ...string) ([]byte, error) {
+		var fields []string
+		for _, arg := range args {
+			if query, ok := strings.CutPrefix(arg, "--query-gpu="); ok {
+				fields = strings.Split(query, ",")
+			}
+		}
+		out := "Unable to determine the device handle for GPU 0000:3B:00.0: Unknown Error\n"
+		if len(fields) == len(nvidiaQueryFields) {
+			out += strings.SplitN(recordedNvidiaSmi, "\n", 2)[0] + "\n"
+		} else {
+			out += "0, 40960\n"
+		}
+		return []byte(out), errors.New("exit status 15")
+	}
+	backend := NewNVIDIABackend(run)
+
+	count, err := backend.Detect()
+	if err == nil || count != 1 {
+		t.Errorf("Detect() = %d, %v, want 1 with an error", count, err)
+	}
+	devices, err := backend.Sample()
+	if err == nil || len(devices) != 1 || devices[0].Card != "nvidia0" {
+		t.Errorf("Sample() = %+v, %v, want nvidia0 with an error", devices, err)
+	}
+}
@@ -0,0 +1,247 @@
+package utility
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GPUProcess is the GPU footprint of one process on one card
+type GPUProcess struct {
+	PID       string
+	Card      string
+	VRAMBytes uint64
+	EngineNs  map[string]uint64 // drm-engine-<name> cumulative busy time
+}
+
+// GPUProcessReader attributes GPU usage to processes using KFD (ROCm compute)
+// and DRM fdinfo (any open DRM driver). Paths are configurable for fixtures.
+type GPUProcessReader struct {
+	procPath string
+	sysPath  string
+}
+
+func NewGPUProcessReader(procPath, sysPath string) *GPUProcessReader {
+	return &GPUProcessReader{procPath: procPath, sysPath: sysPath}
+}
+
+type gpuProcessKey struct {
+	pid, card string
+}
+
+func (r *GPUProcessReader) Read() ([]GPUProcess, error) {
+	cardByPdev := r.cardsByPCIAddress()
+	usage := make(map[gpuProcessKey]*GPUProcess)
+
+	get := func(pid, card string) *GPUProcess {
+		key := gpuProcessKey{pid, card}
+		if p, ok := usage[key]; ok {
+			return p
+		}
+		p := &GPUProcess{PID: pid, Card: card, EngineNs: make(map[string]uint64)}
+		usage[key] = p
+		return p
+	}
+
+	// DRM fdinfo
+	procs, err := os.ReadDir(r.procPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range procs {
+		pid := entry.Name()
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+		for _, client := range r.readDRMClients(pid) {
+			card, ok := cardByPdev[client.pdev]
+			if !ok {
+				continue
+			}
+			p := get(pid, card)
+			p.VRAMBytes += client.vram
+			for engine, ns := range client.engineNs {
+				p.EngineNs[engine] += ns
+			}
+		}
+	}
+
+	// KFD compute allocations. Newer kernels also report these through fdinfo,
+	// so take the larger of the two rather than adding
+	cardByGPUID := r.cardsByKFDGPUID(cardByPdev)
+	kfdProcs, _ := os.ReadDir(filepath.Join(r.sysPath, "class/kfd/kfd/proc"))
+	for _, entry := range kfdProcs {
+		pid := entry.Name()
+		vramFiles, _ := filepath.Glob(filepath.Join(r.sysPath, "class/kfd/kfd/proc", pid, "vram_*"))
+		for _, vramFile := range vramFiles {
+			card, ok := cardByGPUID[strings.TrimPrefix(filepath.Base(vramFile), "vram_")]
+			if !ok {
+				continue
+			}
+			vram, err := readUintFile(vramFile)
+			if err != nil {
+				continue
+			}
+			if p := get(pid, card); vram > p.VRAMBytes {
+				p.VRAMBytes = vram
+			}
+		}
+	}
+
+	processes := make([]GPUProcess, 0, len(usage))
+	for _, p := range usage {
+		processes = append(processes, *p)
+	}
+	return processes, nil
+}
+
+type drmClient struct {
+	pdev     string
+	vram     uint64
+	engineNs map[string]uint64
+}
+
+// readDRMClients parses fdinfo for every DRM fd of a pid. Several fds can share
+// one client, so entries are deduplicated on drm-client-id.
+func (r *GPUProcessReader) readDRMClients(pid string) []drmClient {
+	fdDir := filepath.Join(r.procPath, pid, "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	var clients []drmClient
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil || !strings.HasPrefix(target, "/dev/dri/") {
+			continue
+		}
+		client, id, ok := parseDRMFdinfo(filepath.Join(r.procPath, pid, "fdinfo", fd.Name()))
+		if !ok {
+			continue
+		}
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func parseDRMFdinfo(path string) (drmClient, string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return drmClient{}, "", false
+	}
+	defer file.Close()
+
+	client := drmClient{engineNs: make(map[string]uint64)}
+	var clientID string
+	var residentVRAM uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "drm-client-id":
+			clientID = value
+		case key == "drm-pdev":
+			client.pdev = value
+		case key == "drm-memory-vram":
+			client.vram = parseFdinfoBytes(value)
+		case key == "drm-resident-vram":
+			residentVRAM = parseFdinfoBytes(value)
+		case strings.HasPrefix(key, "drm-engine-") && !strings.HasPrefix(key, "drm-engine-capacity-"):
+			ns, _ := strconv.ParseUint(strings.TrimSuffix(value, " ns"), 10, 64)
+			client.engineNs[strings.TrimPrefix(key, "drm-engine-")] = ns
+		}
+	}
+	if client.vram == 0 {
+		client.vram = residentVRAM
+	}
+	if clientID == "" || client.pdev == "" {
+		return drmClient{}, "", false
+	}
+	return client, clientID, true
+}
+
+// parseFdinfoBytes handles "1024 KiB", "4 MiB" and plain byte counts
+func parseFdinfoBytes(value string) uint64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	if len(fields) > 1 {
+		switch fields[1] {
+		case "KiB":
+			n *= 1024
+		case "MiB":
+			n *= 1024 * 1024
+		case "GiB":
+			n *= 1024 * 1024 * 1024
+		}
+	}
+	return n
+}
+
+// cardsByPCIAddress maps 0000:03:00.0 -> card0
+func (r *GPUProcessReader) cardsByPCIAddress() map[string]string {
+	cards := make(map[string]string)
+	matches, _ := filepath.Glob(filepath.Join(r.sysPath, "class/drm/card[0-9]*"))
+	for _, cardPath := range matches {
+		card := filepath.Base(cardPath)
+		// Skip connectors like card0-DP-1
+		if strings.Contains(card, "-") {
+			continue
+		}
+		if device, err := os.Readlink(filepath.Join(cardPath, "device")); err == nil {
+			cards[filepath.Base(device)] = card
+		}
+	}
+	return cards
+}
+
+// cardsByKFDGPUID maps KFD topology gpu_id -> card via the node's render minor
+func (r *GPUProcessReader) cardsByKFDGPUID(cardByPdev map[string]string) map[string]string {
+	cards := make(map[string]string)
+	nodes, _ := filepath.Glob(filepath.Join(r.sysPath, "class/kfd/kfd/topology/nodes/*"))
+	for _, node := range nodes {
+		gpuID, err := os.ReadFile(filepath.Join(node, "gpu_id"))
+		if err != nil || strings.TrimSpace(string(gpuID)) == "0" {
+			continue // CPU node
+		}
+		properties, err := os.ReadFile(filepath.Join(node, "properties"))
+		if err != nil {
+			continue
+		}
+		var minor string
+		for _, line := range strings.Split(string(properties), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "drm_render_minor" {
+				minor = fields[1]
+			}
+		}
+		if minor == "" {
+			continue
+		}
+		device, err := os.Readlink(filepath.Join(r.sysPath, "class/drm", "renderD"+minor, "device"))
+		if err != nil {
+			continue
+		}
+		if card, ok := cardByPdev[filepath.Base(device)]; ok {
+			cards[strings.TrimSpace(string(gpuID))] = card
+		}
+	}
+	return cards
+}
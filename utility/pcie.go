@@ -0,0 +1,41 @@
+package utility
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadPCIeLink reads the standard PCI sysfs link attributes of a device directory.
+// Speeds look like "16.0 GT/s PCIe", widths are plain lane counts.
+func ReadPCIeLink(deviceDir string) PCIeLink {
+	return PCIeLink{
+		CurrentSpeedGTs: readLinkSpeed(filepath.Join(deviceDir, "current_link_speed")),
+		MaxSpeedGTs:     readLinkSpeed(filepath.Join(deviceDir, "max_link_speed")),
+		CurrentWidth:    readLinkWidth(filepath.Join(deviceDir, "current_link_width")),
+		MaxWidth:        readLinkWidth(filepath.Join(deviceDir, "max_link_width")),
+	}
+}
+
+func readLinkSpeed(path string) float64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	speed, _ := strconv.ParseFloat(fields[0], 64)
+	return speed
+}
+
+func readLinkWidth(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	width, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return width
+}